@@ -0,0 +1,86 @@
+// Command oauth-client registers an OAuth client and prints its credentials.
+// Run it from the project root so .env and firebase.json are found:
+//
+//	go run ./cmd/oauth-client -name "API gateway" -introspect
+//	go run ./cmd/oauth-client -name "Partner app" -grant authorization_code -redirect-uri https://partner.example.com/callback
+//	go run ./cmd/oauth-client -name "Nightly cron" -grant client_credentials -scope profile:read
+//	go run ./cmd/oauth-client -name "Org sync" -grant client_credentials -scope profile:read -org <org id>
+package main
+
+import (
+	"backend/utils"
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// splitList splits a comma separated flag value, ignoring empty entries
+func splitList(value string) []string {
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func main() {
+	name := flag.String("name", "", "human readable name of the client, shown on the consent screen")
+	introspect := flag.Bool("introspect", false, "allow the client to call /oauth/introspect")
+	grants := flag.String("grant", "", "comma separated grant types, e.g. authorization_code")
+	redirectURIs := flag.String("redirect-uri", "", "comma separated redirect URIs for the authorization code flow")
+	scopes := flag.String("scope", "", "comma separated scopes the client may request with the client_credentials grant")
+	public := flag.Bool("public", false, "register a public client (mobile or single page app) without a secret")
+	org := flag.String("org", "", "organization whose members the client's service tokens may reach")
+	flag.Parse()
+
+	if *name == "" {
+		log.Fatal("-name is required")
+	}
+
+	client := &utils.OAuthClient{
+		Name:          *name,
+		Public:        *public,
+		GrantTypes:    splitList(*grants),
+		RedirectURIs:  splitList(*redirectURIs),
+		Scopes:        splitList(*scopes),
+		Org:           *org,
+		CanIntrospect: *introspect,
+	}
+	if client.AllowsGrant(utils.GrantAuthorizationCode) && len(client.RedirectURIs) == 0 {
+		log.Fatal("-redirect-uri is required for the authorization_code grant")
+	}
+	if client.Public && (client.CanIntrospect || client.AllowsGrant(utils.GrantClientCredentials)) {
+		log.Fatal("public clients cannot introspect tokens or use the client_credentials grant")
+	}
+	for _, scope := range client.Scopes {
+		if !utils.IsDelegableScope(scope) {
+			log.Fatalf("scope %q cannot be granted to a client", scope)
+		}
+	}
+
+	utils.InitFirebase()
+
+	if client.Org != "" {
+		existing, err := utils.GetOrg(client.Org)
+		if err != nil {
+			log.Fatalf("Error retrieving organization: %v\n", err)
+		}
+		if existing == nil {
+			log.Fatalf("organization %q does not exist", client.Org)
+		}
+	}
+
+	secret, err := utils.CreateOAuthClient(client)
+	if err != nil {
+		log.Fatalf("Error creating OAuth client: %v\n", err)
+	}
+
+	fmt.Printf("client_id:     %s\n", client.ID)
+	if !client.Public {
+		fmt.Printf("client_secret: %s\n", secret)
+		fmt.Println("The secret is not stored and cannot be shown again.")
+	}
+}
@@ -0,0 +1,101 @@
+// Command reconcile-claims brings every user's Firebase custom claims in line
+// with the roles stored under users/{uid}, which are authoritative. It also
+// replaces display names that still hold a role, as registration used to set
+// them, with the user's name. Run it from the project root so .env and
+// firebase.json are found:
+//
+//	go run ./cmd/reconcile-claims -dry-run
+//	go run ./cmd/reconcile-claims
+package main
+
+import (
+	"backend/utils"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+
+	"firebase.google.com/go/auth"
+	"google.golang.org/api/iterator"
+)
+
+func main() {
+	dryRun := flag.Bool("dry-run", false, "only report the users that have drifted")
+	flag.Parse()
+
+	utils.InitFirebase()
+	utils.InitRoles()
+
+	var checked, fixed, failed int
+	it := utils.FirebaseAuth.Users(context.Background(), "")
+	for {
+		user, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			log.Fatalf("Error listing users: %v\n", err)
+		}
+		checked++
+
+		changed, err := reconcile(user.UserRecord, *dryRun)
+		if err != nil {
+			failed++
+			log.Printf("Failed to reconcile %s: %v\n", user.UID, err)
+			continue
+		}
+		if changed {
+			fixed++
+		}
+	}
+
+	verb := "fixed"
+	if *dryRun {
+		verb = "drifted"
+	}
+	fmt.Printf("%d users checked, %d %s, %d failed\n", checked, fixed, verb, failed)
+	if failed > 0 {
+		log.Fatal("some users could not be reconciled")
+	}
+}
+
+// reconcile fixes the custom claims and display name of one user and reports
+// whether anything had drifted
+func reconcile(user *auth.UserRecord, dryRun bool) (bool, error) {
+	roles, err := utils.GetUserRoles(user.UID)
+	if err != nil {
+		return false, err
+	}
+
+	changed := false
+	if roles.Role != "" && !utils.RoleClaimsInSync(user.CustomClaims, roles) {
+		changed = true
+		fmt.Printf("%s: custom claims %v, roles %v\n", user.UID, user.CustomClaims, roles.List())
+		if !dryRun {
+			if err := utils.SyncRoleClaims(user.UID, roles); err != nil {
+				return changed, err
+			}
+		}
+	}
+
+	if user.UserInfo != nil && utils.IsKnownRole(user.DisplayName) {
+		var name string
+		if err := utils.FirebaseDB.NewRef("users/"+user.UID+"/name").Get(context.Background(), &name); err != nil {
+			return changed, err
+		}
+		if name == user.DisplayName {
+			return changed, nil
+		}
+		changed = true
+		fmt.Printf("%s: display name %q, name %q\n", user.UID, user.DisplayName, name)
+		if !dryRun {
+			// An empty display name removes it
+			params := (&auth.UserToUpdate{}).DisplayName(name)
+			if _, err := utils.FirebaseAuth.UpdateUser(context.Background(), user.UID, params); err != nil {
+				return changed, err
+			}
+		}
+	}
+
+	return changed, nil
+}
@@ -0,0 +1,342 @@
+package controller
+
+import (
+	"backend/utils"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"firebase.google.com/go/auth"
+	"github.com/gorilla/mux"
+	"google.golang.org/api/iterator"
+)
+
+// Page sizes of GET /admin/users
+const (
+	defaultUsersPageSize = 50
+	maxUsersPageSize     = 100
+)
+
+// AdminUser is a user as shown to admins, combining the Firebase Auth record
+// with the roles and profile stored under users/{uid}
+type AdminUser struct {
+	UID           string `json:"uid"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Disabled      bool   `json:"disabled"`
+	utils.UserRoles
+	Name        string `json:"name,omitempty"`
+	PhoneNumber string `json:"phone_number,omitempty"`
+	Gender      string `json:"gender,omitempty"`
+	City        string `json:"city,omitempty"`
+	CreatedAt   int64  `json:"created_at"`
+	LastLoginAt int64  `json:"last_login_at,omitempty"`
+}
+
+// newAdminUser fills in the fields taken from the Firebase Auth record
+func newAdminUser(u *auth.UserRecord) AdminUser {
+	user := AdminUser{
+		UID:           u.UID,
+		Email:         u.Email,
+		EmailVerified: u.EmailVerified,
+		Disabled:      u.Disabled,
+	}
+	if u.UserMetadata != nil {
+		user.CreatedAt = u.UserMetadata.CreationTimestamp / 1000
+		user.LastLoginAt = u.UserMetadata.LastLogInTimestamp / 1000
+	}
+	return user
+}
+
+// inTenant checks that the user is within the caller's tenant scope and
+// answers 404 otherwise, so other tenants' users cannot be probed
+func inTenant(w http.ResponseWriter, r *http.Request, uid string) bool {
+	scope, err := utils.NewTenantScope(r.Context().Value("claims").(*utils.Claims))
+	var ok bool
+	if err == nil {
+		ok, err = scope.Includes(uid)
+	}
+	if err != nil {
+		http.Error(w, "Failed to retrieve user", http.StatusInternalServerError)
+		log.Printf("Failed to check tenant scope: %v\n", err)
+		return false
+	}
+	if !ok {
+		http.Error(w, "User not found", http.StatusNotFound)
+	}
+	return ok
+}
+
+// ListUsersHandler lists users page by page. Filters (role, disabled,
+// email_verified, email) and the caller's tenant scope are applied to each
+// page, so a page can hold fewer than limit users while next_page_token is
+// still set.
+func ListUsersHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	limit := defaultUsersPageSize
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxUsersPageSize {
+			http.Error(w, "limit must be between 1 and 100", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	var disabled, emailVerified *bool
+	for name, target := range map[string]**bool{"disabled": &disabled, "email_verified": &emailVerified} {
+		if v := query.Get(name); v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				http.Error(w, name+" must be true or false", http.StatusBadRequest)
+				return
+			}
+			*target = &b
+		}
+	}
+	role := query.Get("role")
+	email := strings.ToLower(query.Get("email"))
+
+	scope, err := utils.NewTenantScope(r.Context().Value("claims").(*utils.Claims))
+	if err != nil {
+		http.Error(w, "Failed to list users", http.StatusInternalServerError)
+		log.Printf("Failed to get tenant scope: %v\n", err)
+		return
+	}
+
+	var records []*auth.ExportedUserRecord
+	pager := iterator.NewPager(utils.FirebaseAuth.Users(context.Background(), ""), limit, query.Get("page_token"))
+	nextPageToken, err := pager.NextPage(&records)
+	if err != nil {
+		http.Error(w, "Failed to list users", http.StatusInternalServerError)
+		log.Printf("Failed to list users: %v\n", err)
+		return
+	}
+
+	users := make([]AdminUser, 0, len(records))
+	for _, record := range records {
+		if disabled != nil && record.Disabled != *disabled {
+			continue
+		}
+		if emailVerified != nil && record.EmailVerified != *emailVerified {
+			continue
+		}
+		if email != "" && !strings.Contains(strings.ToLower(record.Email), email) {
+			continue
+		}
+
+		included, err := scope.Includes(record.UID)
+		if err != nil {
+			http.Error(w, "Failed to list users", http.StatusInternalServerError)
+			log.Printf("Failed to check tenant scope: %v\n", err)
+			return
+		}
+		if !included {
+			continue
+		}
+
+		user := newAdminUser(record.UserRecord)
+		if user.UserRoles, err = utils.GetUserRoles(record.UID); err != nil {
+			http.Error(w, "Failed to list users", http.StatusInternalServerError)
+			log.Printf("Failed to get user roles: %v\n", err)
+			return
+		}
+		if role != "" && !hasAssignedRole(user.UserRoles, role) {
+			continue
+		}
+		users = append(users, user)
+	}
+
+	response := map[string]interface{}{"users": users}
+	if nextPageToken != "" {
+		response["next_page_token"] = nextPageToken
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, "Failed to write response", http.StatusInternalServerError)
+		log.Printf("Failed to encode response: %v\n", err)
+	}
+}
+
+// hasAssignedRole reports whether the role was given to the user directly.
+// Unlike HasRole it ignores inheritance, so role=user does not match admins.
+func hasAssignedRole(roles utils.UserRoles, role string) bool {
+	for _, r := range roles.List() {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// GetUserHandler shows a single user
+func GetUserHandler(w http.ResponseWriter, r *http.Request) {
+	uid := mux.Vars(r)["uid"]
+	if !inTenant(w, r, uid) {
+		return
+	}
+
+	record, err := utils.FirebaseAuth.GetUser(context.Background(), uid)
+	if auth.IsUserNotFound(err) {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to retrieve user", http.StatusInternalServerError)
+		log.Printf("Failed to get user: %v\n", err)
+		return
+	}
+
+	// The profile fields are read into a copy so they cannot overwrite the
+	// Firebase Auth fields
+	var profile AdminUser
+	if err := utils.FirebaseDB.NewRef("users/"+uid).Get(context.Background(), &profile); err != nil {
+		http.Error(w, "Failed to retrieve user", http.StatusInternalServerError)
+		log.Printf("Failed to get user profile: %v\n", err)
+		return
+	}
+	user := newAdminUser(record)
+	user.UserRoles = profile.UserRoles
+	user.Name = profile.Name
+	user.PhoneNumber = profile.PhoneNumber
+	user.Gender = profile.Gender
+	user.City = profile.City
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(user); err != nil {
+		http.Error(w, "Failed to write response", http.StatusInternalServerError)
+		log.Printf("Failed to encode response: %v\n", err)
+	}
+}
+
+// targetUser returns the uid of the route after checking that the user exists,
+// is within the caller's tenant scope and is not the caller, since admins must
+// not lock themselves out
+func targetUser(w http.ResponseWriter, r *http.Request) (string, bool) {
+	uid := mux.Vars(r)["uid"]
+	if uid == r.Context().Value("uid").(string) {
+		utils.Forbidden(w, "Admins cannot change their own account here")
+		return "", false
+	}
+	if !inTenant(w, r, uid) {
+		return "", false
+	}
+
+	if _, err := utils.FirebaseAuth.GetUser(context.Background(), uid); err != nil {
+		if auth.IsUserNotFound(err) {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return "", false
+		}
+		http.Error(w, "Failed to retrieve user", http.StatusInternalServerError)
+		log.Printf("Failed to get user: %v\n", err)
+		return "", false
+	}
+	return uid, true
+}
+
+// SetUserRolesHandler replaces a user's roles
+func SetUserRolesHandler(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Roles []string `json:"roles"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+	// Admins may assign any role in the registry, not only self-assignable ones
+	if err := utils.ValidateRoles(req.Roles, false); err != nil {
+		http.Error(w, "Invalid roles: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	uid, ok := targetUser(w, r)
+	if !ok {
+		return
+	}
+
+	if err := utils.SetUserRoles(uid, req.Roles); err != nil {
+		http.Error(w, "Failed to update roles", http.StatusInternalServerError)
+		log.Printf("Failed to set user roles: %v\n", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("Roles updated successfully"))
+}
+
+// DisableUserHandler disables an account and ends all of its sessions
+func DisableUserHandler(w http.ResponseWriter, r *http.Request) {
+	setUserDisabled(w, r, true)
+}
+
+// EnableUserHandler re-enables a disabled account
+func EnableUserHandler(w http.ResponseWriter, r *http.Request) {
+	setUserDisabled(w, r, false)
+}
+
+func setUserDisabled(w http.ResponseWriter, r *http.Request, disabled bool) {
+	uid, ok := targetUser(w, r)
+	if !ok {
+		return
+	}
+
+	if err := utils.SetUserDisabled(uid, disabled); err != nil {
+		http.Error(w, "Failed to update account", http.StatusInternalServerError)
+		log.Printf("Failed to set user disabled: %v\n", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	if disabled {
+		w.Write([]byte("Account disabled successfully"))
+	} else {
+		w.Write([]byte("Account enabled successfully"))
+	}
+}
+
+// VerifyUserEmailHandler marks a user's email address as verified
+func VerifyUserEmailHandler(w http.ResponseWriter, r *http.Request) {
+	uid, ok := targetUser(w, r)
+	if !ok {
+		return
+	}
+
+	if err := utils.SetEmailVerified(uid); err != nil {
+		http.Error(w, "Failed to verify email", http.StatusInternalServerError)
+		log.Printf("Failed to set email verified: %v\n", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("Email marked as verified"))
+}
+
+// DeleteUserHandler deletes a user from Firebase Auth and the database
+func DeleteUserHandler(w http.ResponseWriter, r *http.Request) {
+	uid, ok := targetUser(w, r)
+	if !ok {
+		return
+	}
+
+	err := utils.DeleteUser(uid)
+	if errors.Is(err, utils.ErrLastOrgAdmin) {
+		http.Error(w, "The user is the only admin of an organization", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to delete user", http.StatusInternalServerError)
+		log.Printf("Failed to delete user: %v\n", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("User deleted successfully"))
+}
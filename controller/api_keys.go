@@ -0,0 +1,144 @@
+package controller
+
+import (
+	"backend/utils"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// CreateAPIKeyRequest structure for the request body
+type CreateAPIKeyRequest struct {
+	Name          string   `json:"name"`
+	Scopes        []string `json:"scopes"`
+	ExpiresInDays int      `json:"expires_in_days"` // 0 for a key that does not expire
+}
+
+// CreateAPIKeyResponse carries the only copy of the key the server ever returns
+type CreateAPIKeyResponse struct {
+	Key string `json:"key"`
+	utils.APIKey
+}
+
+// canManageAPIKeys refuses requests authenticated with an API key. The
+// api_keys:manage permission is checked by the authorization policy.
+func canManageAPIKeys(w http.ResponseWriter, claims *utils.Claims) bool {
+	if claims.Source == utils.TokenSourceAPIKey {
+		utils.Forbidden(w, "API keys cannot manage API keys")
+		return false
+	}
+	return true
+}
+
+// CreateAPIKeyHandler creates a named, scoped API key for the organizer
+func CreateAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*utils.Claims)
+	if !canManageAPIKeys(w, claims) {
+		return
+	}
+
+	var req CreateAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	if req.Name == "" {
+		http.Error(w, "Name is required", http.StatusBadRequest)
+		return
+	}
+	if len(req.Scopes) == 0 {
+		http.Error(w, "At least one scope is required", http.StatusBadRequest)
+		return
+	}
+	for _, scope := range req.Scopes {
+		if !utils.IsKnownScope(scope) {
+			http.Error(w, "Unknown scope: "+scope, http.StatusBadRequest)
+			return
+		}
+		if !utils.IsDelegableScope(scope) {
+			http.Error(w, "API keys cannot be granted the "+scope+" scope", http.StatusBadRequest)
+			return
+		}
+	}
+	if req.ExpiresInDays < 0 {
+		http.Error(w, "Invalid expiry", http.StatusBadRequest)
+		return
+	}
+
+	var expiresAt time.Time
+	if req.ExpiresInDays > 0 {
+		expiresAt = time.Now().AddDate(0, 0, req.ExpiresInDays)
+	}
+
+	key, record, err := utils.CreateAPIKey(claims.UID, req.Name, req.Scopes, expiresAt)
+	if err != nil {
+		http.Error(w, "Failed to create API key", http.StatusInternalServerError)
+		log.Printf("Failed to create API key: %v\n", err)
+		return
+	}
+	record.Hash = ""
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(CreateAPIKeyResponse{Key: key, APIKey: *record}); err != nil {
+		http.Error(w, "Failed to write response", http.StatusInternalServerError)
+		log.Printf("Failed to encode response: %v\n", err)
+	}
+}
+
+// ListAPIKeysHandler lists the organizer's API keys without their secrets
+func ListAPIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*utils.Claims)
+	if !canManageAPIKeys(w, claims) {
+		return
+	}
+
+	keys, err := utils.ListAPIKeys(claims.UID)
+	if err != nil {
+		http.Error(w, "Failed to retrieve API keys", http.StatusInternalServerError)
+		log.Printf("Failed to list API keys: %v\n", err)
+		return
+	}
+	for i := range keys {
+		keys[i].Hash = ""
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(keys); err != nil {
+		http.Error(w, "Failed to write response", http.StatusInternalServerError)
+		log.Printf("Failed to encode response: %v\n", err)
+	}
+}
+
+// RevokeAPIKeyHandler deletes one of the organizer's API keys
+func RevokeAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*utils.Claims)
+	if !canManageAPIKeys(w, claims) {
+		return
+	}
+
+	key, err := utils.GetAPIKey(claims.UID, mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Failed to retrieve API key", http.StatusInternalServerError)
+		log.Printf("Failed to get API key: %v\n", err)
+		return
+	}
+	if key == nil {
+		http.Error(w, "API key not found", http.StatusNotFound)
+		return
+	}
+
+	if err := utils.RevokeAPIKey(claims.UID, key); err != nil {
+		http.Error(w, "Failed to revoke API key", http.StatusInternalServerError)
+		log.Printf("Failed to revoke API key: %v\n", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("API key revoked successfully"))
+}
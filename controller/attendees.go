@@ -0,0 +1,38 @@
+package controller
+
+import (
+	"backend/utils"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// AttendeeResource loads the attendee of the route for attribute rules
+func AttendeeResource(r *http.Request) (map[string]interface{}, error) {
+	return utils.UserAttributes(mux.Vars(r)["uid"])
+}
+
+// AttendeeProfileHandler shows another user's profile. Who may see whom is
+// decided by the attribute rules for attendee:view, e.g. organizers only see
+// attendees in their own city.
+func AttendeeProfileHandler(w http.ResponseWriter, r *http.Request) {
+	uid := mux.Vars(r)["uid"]
+
+	var profile ServiceProfile
+	if err := utils.FirebaseDB.NewRef("users/"+uid).Get(context.Background(), &profile); err != nil {
+		http.Error(w, "Failed to retrieve user profile", http.StatusInternalServerError)
+		log.Printf("Failed to get user profile: %v\n", err)
+		return
+	}
+	profile.UID = uid
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(profile); err != nil {
+		http.Error(w, "Failed to write response", http.StatusInternalServerError)
+		log.Printf("Failed to encode response: %v\n", err)
+	}
+}
@@ -0,0 +1,51 @@
+package controller
+
+import (
+	"backend/utils"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+)
+
+// ChangePasswordRequest structure for the request body
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+// ChangePasswordHandler replaces the user's password. All tokens issued so
+// far, including the one used for this request, stop working.
+func ChangePasswordHandler(w http.ResponseWriter, r *http.Request) {
+	uid := r.Context().Value("uid").(string)
+
+	var req ChangePasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	if req.CurrentPassword == "" || req.NewPassword == "" {
+		http.Error(w, "Current and new password are required", http.StatusBadRequest)
+		return
+	}
+
+	if err := utils.CheckPassword(uid, req.CurrentPassword); err != nil {
+		if errors.Is(err, utils.ErrInvalidCredentials) {
+			http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+			return
+		}
+		http.Error(w, "Failed to retrieve user details", http.StatusInternalServerError)
+		log.Printf("Failed to check password: %v\n", err)
+		return
+	}
+
+	if err := utils.SetUserPassword(uid, req.NewPassword); err != nil {
+		http.Error(w, "Failed to change password", http.StatusInternalServerError)
+		log.Printf("Failed to change password: %v\n", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("Password changed successfully. Please log in again"))
+}
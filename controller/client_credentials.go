@@ -0,0 +1,94 @@
+package controller
+
+import (
+	"backend/utils"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// issueClientCredentialsToken issues a service token to a confidential client
+// for its own use (RFC 6749 section 4.4). The token's principal type tells it
+// apart from user tokens.
+func issueClientCredentialsToken(w http.ResponseWriter, r *http.Request, client *utils.OAuthClient) {
+	if client.Public {
+		writeOAuthError(w, http.StatusBadRequest, "unauthorized_client", "Public clients cannot use the client_credentials grant")
+		return
+	}
+
+	// Default to everything the client is registered for
+	scopes := strings.Fields(r.PostFormValue("scope"))
+	if len(scopes) == 0 {
+		scopes = client.Scopes
+	}
+	for _, scope := range scopes {
+		if !client.AllowsScope(scope) {
+			writeOAuthError(w, http.StatusBadRequest, "invalid_scope", "Client may not request scope "+scope)
+			return
+		}
+	}
+
+	scope := strings.Join(scopes, " ")
+	token, err := utils.GenerateJWT(&utils.Claims{
+		UID:           client.ID,
+		PrincipalType: utils.PrincipalService,
+		ClientID:      client.ID,
+		Org:           client.Org,
+		Scope:         scope,
+	})
+	if err != nil {
+		writeOAuthError(w, http.StatusInternalServerError, "server_error", "Error generating token")
+		return
+	}
+
+	writeOAuthJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": token,
+		"token_type":   "Bearer",
+		"expires_in":   int(utils.AccessTokenTTL.Seconds()),
+		"scope":        scope,
+	})
+}
+
+// ServiceProfile is the part of a user's profile released to service clients
+type ServiceProfile struct {
+	UID string `json:"uid"`
+	utils.UserRoles
+	PhoneNumber string `json:"phone_number,omitempty"`
+	Name        string `json:"name,omitempty"`
+	Gender      string `json:"gender,omitempty"`
+	City        string `json:"city,omitempty"`
+}
+
+// ServiceUserProfileHandler lets service clients read the profile of a user
+// within their tenant scope: the members of the org the client is bound to,
+// or users outside any org
+func ServiceUserProfileHandler(w http.ResponseWriter, r *http.Request) {
+	uid := mux.Vars(r)["uid"]
+
+	if !inTenant(w, r, uid) {
+		return
+	}
+
+	var profile ServiceProfile
+	if err := utils.FirebaseDB.NewRef("users/"+uid).Get(context.Background(), &profile); err != nil {
+		http.Error(w, "Failed to retrieve user profile", http.StatusInternalServerError)
+		log.Printf("Failed to get user profile: %v\n", err)
+		return
+	}
+	if profile.Role == "" {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	profile.UID = uid
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(profile); err != nil {
+		http.Error(w, "Failed to write response", http.StatusInternalServerError)
+		log.Printf("Failed to encode response: %v\n", err)
+	}
+}
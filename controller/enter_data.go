@@ -6,6 +6,8 @@ import (
 	"encoding/json"
 	"log"
 	"net/http"
+
+	"firebase.google.com/go/auth"
 )
 
 // EnterDataRequest structure for the request body
@@ -64,6 +66,16 @@ func EnterDataHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Keep the Firebase display name in step with the profile
+	if req.Name != "" {
+		params := (&auth.UserToUpdate{}).DisplayName(req.Name)
+		if _, err := utils.FirebaseAuth.UpdateUser(context.Background(), uid, params); err != nil {
+			http.Error(w, "Failed to update user data", http.StatusInternalServerError)
+			log.Printf("Error updating display name: %v\n", err)
+			return
+		}
+	}
+
 	w.WriteHeader(http.StatusOK)
 	if err := json.NewEncoder(w).Encode(map[string]string{"message": "User data updated successfully"}); err != nil {
 		http.Error(w, "Failed to write response", http.StatusInternalServerError)
@@ -0,0 +1,87 @@
+package controller
+
+import (
+	"backend/utils"
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// ExplainRequest asks how the attribute rules decide an action. The principal
+// and resource are given either as a uid whose attributes are loaded, or as
+// attributes directly; principal_uid defaults to the caller.
+type ExplainRequest struct {
+	Action       string                 `json:"action"`
+	PrincipalUID string                 `json:"principal_uid"`
+	Principal    map[string]interface{} `json:"principal"`
+	ResourceUID  string                 `json:"resource_uid"`
+	Resource     map[string]interface{} `json:"resource"`
+	Request      map[string]interface{} `json:"request"`
+}
+
+// ExplainDecisionHandler evaluates the attribute rules without acting on the
+// decision and returns it with the trace of every rule, for debugging policies
+func ExplainDecisionHandler(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*utils.Claims)
+
+	var req ExplainRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+	if req.Action == "" {
+		http.Error(w, "action is required", http.StatusBadRequest)
+		return
+	}
+
+	principal := req.Principal
+	if principal == nil {
+		var err error
+		if req.PrincipalUID == "" {
+			principal, err = utils.PrincipalAttributes(claims)
+		} else {
+			principal, err = utils.UserAttributes(req.PrincipalUID)
+		}
+		if err != nil {
+			http.Error(w, "Failed to load principal attributes", http.StatusInternalServerError)
+			log.Printf("Failed to load principal attributes: %v\n", err)
+			return
+		}
+		if principal == nil {
+			http.Error(w, "Principal not found", http.StatusNotFound)
+			return
+		}
+	}
+
+	resource := req.Resource
+	if resource == nil && req.ResourceUID != "" {
+		var err error
+		if resource, err = utils.UserAttributes(req.ResourceUID); err != nil {
+			http.Error(w, "Failed to load resource attributes", http.StatusInternalServerError)
+			log.Printf("Failed to load resource attributes: %v\n", err)
+			return
+		}
+		if resource == nil {
+			http.Error(w, "Resource not found", http.StatusNotFound)
+			return
+		}
+	}
+
+	request := req.Request
+	if request == nil {
+		request = utils.RequestAttributes(r)
+	}
+
+	decision := utils.Authorize(req.Action, utils.Attributes{
+		utils.AttrPrincipal: principal,
+		utils.AttrResource:  resource,
+		utils.AttrRequest:   request,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(decision); err != nil {
+		http.Error(w, "Failed to write response", http.StatusInternalServerError)
+		log.Printf("Failed to encode response: %v\n", err)
+	}
+}
@@ -0,0 +1,132 @@
+package controller
+
+import (
+	"backend/utils"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// maxImpersonationTTL caps how long an impersonation token stays valid
+const maxImpersonationTTL = 30 * time.Minute
+
+// ImpersonateRequest structure for the request body
+type ImpersonateRequest struct {
+	UID        string `json:"uid"`
+	Reason     string `json:"reason"`
+	Scope      string `json:"scope"`       // defaults to profile:read
+	TTLMinutes int    `json:"ttl_minutes"` // defaults to 15, at most 30
+}
+
+// ImpersonateHandler lets an admin act as another user for support. The token
+// carries an act claim naming the admin, and its issuance and every request
+// made with it are written to the audit trail.
+func ImpersonateHandler(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*utils.Claims)
+
+	if claims.Source != "" || claims.Act != nil {
+		utils.Forbidden(w, "Impersonation requires an admin access token")
+		return
+	}
+
+	var req ImpersonateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	if req.UID == "" || req.Reason == "" {
+		http.Error(w, "UID and reason are required", http.StatusBadRequest)
+		return
+	}
+	if req.UID == claims.UID {
+		http.Error(w, "Cannot impersonate yourself", http.StatusBadRequest)
+		return
+	}
+
+	ttl := 15 * time.Minute
+	if req.TTLMinutes != 0 {
+		ttl = time.Duration(req.TTLMinutes) * time.Minute
+	}
+	if ttl <= 0 || ttl > maxImpersonationTTL {
+		http.Error(w, "ttl_minutes must be between 1 and 30", http.StatusBadRequest)
+		return
+	}
+
+	scopes := strings.Fields(req.Scope)
+	if len(scopes) == 0 {
+		scopes = []string{utils.ScopeProfileRead}
+	}
+	for _, scope := range scopes {
+		if !utils.IsDelegableScope(scope) {
+			http.Error(w, "Scope cannot be granted to an impersonation token: "+scope, http.StatusBadRequest)
+			return
+		}
+	}
+
+	if !inTenant(w, r, req.UID) {
+		return
+	}
+
+	var target UserDetails
+	if err := utils.FirebaseDB.NewRef("users/"+req.UID).Get(context.Background(), &target); err != nil {
+		http.Error(w, "Failed to retrieve user details", http.StatusInternalServerError)
+		log.Printf("Failed to get impersonation target: %v\n", err)
+		return
+	}
+	if target.Role == "" {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if target.HasRole(utils.RoleAdmin) {
+		utils.Forbidden(w, "Admins cannot be impersonated")
+		return
+	}
+
+	impersonation := &utils.Claims{
+		UID:          req.UID,
+		UserRoles:    target.UserRoles,
+		Scope:        strings.Join(scopes, " "),
+		Act:          &utils.Actor{Sub: claims.UID},
+		TokenVersion: target.TokenVersion,
+	}
+	token, err := utils.GenerateJWTWithTTL(impersonation, ttl)
+	if err != nil {
+		http.Error(w, "Error generating token", http.StatusInternalServerError)
+		return
+	}
+
+	err = utils.RecordImpersonation(&utils.ImpersonationAudit{
+		Event:  utils.AuditImpersonationIssued,
+		Admin:  claims.UID,
+		Target: req.UID,
+		JTI:    impersonation.Id,
+		Reason: req.Reason,
+	})
+	if err != nil {
+		// An unaudited token must not be handed out
+		if err := utils.RevokeToken(impersonation); err != nil {
+			log.Printf("Failed to revoke unaudited impersonation token: %v\n", err)
+		}
+		http.Error(w, "Failed to record audit trail", http.StatusInternalServerError)
+		log.Printf("Failed to record impersonation: %v\n", err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"jwt_token":  token,
+		"token_type": "Bearer",
+		"expires_in": int(ttl.Seconds()),
+		"scope":      impersonation.Scope,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, "Failed to write response", http.StatusInternalServerError)
+		log.Printf("Failed to encode response: %v\n", err)
+	}
+}
@@ -0,0 +1,338 @@
+package controller
+
+import (
+	"backend/utils"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"firebase.google.com/go/auth"
+	"github.com/gorilla/mux"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// InvitationRequest structure for the request body
+type InvitationRequest struct {
+	Email string   `json:"email"`
+	Roles []string `json:"roles"`
+}
+
+// CreateInvitationHandler invites someone by email to join with preset
+// roles. The caller can only hand out roles they hold themselves.
+func CreateInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*utils.Claims)
+
+	var req InvitationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	req.Email = strings.TrimSpace(req.Email)
+	if !strings.Contains(req.Email, "@") {
+		http.Error(w, "A valid email is required", http.StatusBadRequest)
+		return
+	}
+	if err := utils.ValidateRoles(req.Roles, false); err != nil {
+		http.Error(w, "Invalid roles: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	for _, role := range req.Roles {
+		if !claims.HasRole(role) {
+			utils.Forbidden(w, "Cannot invite with a role you do not hold: "+role)
+			return
+		}
+	}
+
+	// Without a link to send there is no point in creating the invitation
+	link, err := utils.InvitationURL()
+	if err != nil {
+		http.Error(w, "Invitations are not configured", http.StatusServiceUnavailable)
+		log.Printf("Cannot build invitation link: %v\n", err)
+		return
+	}
+
+	var inviterName string
+	if err := utils.FirebaseDB.NewRef("users/"+claims.UID+"/name").Get(context.Background(), &inviterName); err != nil {
+		http.Error(w, "Failed to retrieve user details", http.StatusInternalServerError)
+		log.Printf("Failed to get inviter name: %v\n", err)
+		return
+	}
+
+	invitation, token, err := utils.CreateInvitation(claims.UID, req.Email, req.Roles)
+	if err != nil {
+		http.Error(w, "Failed to create invitation", http.StatusInternalServerError)
+		log.Printf("Failed to create invitation: %v\n", err)
+		return
+	}
+
+	// An invitation nobody received is of no use, take it back
+	err = utils.SendInvitationEmail(req.Email, inviterName, utils.InvitationLink(link, token), time.Unix(invitation.ExpiresAt, 0))
+	if err != nil {
+		if err := utils.RevokeInvitation(invitation.ID); err != nil {
+			log.Printf("Failed to revoke unsent invitation: %v\n", err)
+		}
+		http.Error(w, "Failed to send invitation email", http.StatusInternalServerError)
+		log.Printf("Failed to send invitation email: %v\n", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(invitation); err != nil {
+		http.Error(w, "Failed to write response", http.StatusInternalServerError)
+		log.Printf("Failed to encode response: %v\n", err)
+	}
+}
+
+// ListInvitationsHandler lists the invitations the caller has sent
+func ListInvitationsHandler(w http.ResponseWriter, r *http.Request) {
+	uid := r.Context().Value("uid").(string)
+
+	invitations, err := utils.ListInvitations(uid)
+	if err != nil {
+		http.Error(w, "Failed to retrieve invitations", http.StatusInternalServerError)
+		log.Printf("Failed to list invitations: %v\n", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(invitations); err != nil {
+		http.Error(w, "Failed to write response", http.StatusInternalServerError)
+		log.Printf("Failed to encode response: %v\n", err)
+	}
+}
+
+// RevokeInvitationHandler makes a pending invitation's link unusable. Admins
+// may revoke invitations sent by anyone.
+func RevokeInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*utils.Claims)
+	id := mux.Vars(r)["id"]
+
+	invitation, err := utils.GetInvitation(id)
+	if err != nil {
+		http.Error(w, "Failed to retrieve invitation", http.StatusInternalServerError)
+		log.Printf("Failed to get invitation: %v\n", err)
+		return
+	}
+	if invitation == nil || (invitation.InvitedBy != claims.UID && !claims.HasPermission(utils.PermissionManageUsers)) {
+		http.Error(w, "Invitation not found", http.StatusNotFound)
+		return
+	}
+
+	err = utils.RevokeInvitation(id)
+	if errors.Is(err, utils.ErrInvitationInvalid) {
+		http.Error(w, "Invitation is no longer pending", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to revoke invitation", http.StatusInternalServerError)
+		log.Printf("Failed to revoke invitation: %v\n", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("Invitation revoked successfully"))
+}
+
+// InvitationDetailsHandler shows what an invitation link is for, so the
+// accept page knows whether to ask for a password
+func InvitationDetailsHandler(w http.ResponseWriter, r *http.Request) {
+	invitation, err := utils.VerifyInvitation(r.URL.Query().Get("token"))
+	if errors.Is(err, utils.ErrInvitationInvalid) {
+		http.Error(w, "Invalid or expired invitation", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to retrieve invitation", http.StatusInternalServerError)
+		log.Printf("Failed to verify invitation: %v\n", err)
+		return
+	}
+
+	_, err = utils.FirebaseAuth.GetUserByEmail(context.Background(), invitation.Email)
+	if err != nil && !auth.IsUserNotFound(err) {
+		http.Error(w, "Failed to retrieve user details", http.StatusInternalServerError)
+		log.Printf("Failed to get user by email: %v\n", err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"email":            invitation.Email,
+		"roles":            invitation.Roles,
+		"expires_at":       invitation.ExpiresAt,
+		"existing_account": err == nil,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, "Failed to write response", http.StatusInternalServerError)
+		log.Printf("Failed to encode response: %v\n", err)
+	}
+}
+
+// AcceptInvitationRequest structure for the request body. Name and password
+// are only used when the invitation creates a new account.
+type AcceptInvitationRequest struct {
+	Token    string `json:"token"`
+	Name     string `json:"name"`
+	Password string `json:"password"`
+}
+
+// AcceptInvitationHandler redeems an invitation link. Invitees without an
+// account are registered with the invited roles; the link proves they own
+// the address, so it counts as verified. Existing accounts get the invited
+// roles added to theirs, but only if the caller is logged in to that account:
+// the link alone does not prove who controls it.
+func AcceptInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	claims, _ := r.Context().Value("claims").(*utils.Claims)
+
+	var req AcceptInvitationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	invitation, err := utils.VerifyInvitation(req.Token)
+	if errors.Is(err, utils.ErrInvitationInvalid) {
+		http.Error(w, "Invalid or expired invitation", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to retrieve invitation", http.StatusInternalServerError)
+		log.Printf("Failed to verify invitation: %v\n", err)
+		return
+	}
+
+	existing, err := utils.FirebaseAuth.GetUserByEmail(context.Background(), invitation.Email)
+	if err != nil && !auth.IsUserNotFound(err) {
+		http.Error(w, "Failed to retrieve user details", http.StatusInternalServerError)
+		log.Printf("Failed to get user by email: %v\n", err)
+		return
+	}
+	if existing == nil && req.Password == "" {
+		http.Error(w, "Password is required", http.StatusBadRequest)
+		return
+	}
+	if existing != nil {
+		if claims == nil {
+			http.Error(w, "Log in to the invited account to accept the invitation", http.StatusUnauthorized)
+			return
+		}
+		if claims.UID != existing.UID {
+			utils.Forbidden(w, "The invitation is for another account")
+			return
+		}
+		// Only the account's own login tokens carry the account scope
+		if !claims.HasScope(utils.ScopeAccount) {
+			utils.Forbidden(w, "Accepting an invitation requires a login token")
+			return
+		}
+	}
+
+	// Use up the link first, so it cannot set up two accounts
+	err = utils.AcceptInvitation(invitation.ID)
+	if errors.Is(err, utils.ErrInvitationInvalid) {
+		http.Error(w, "Invalid or expired invitation", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to accept invitation", http.StatusInternalServerError)
+		log.Printf("Failed to accept invitation: %v\n", err)
+		return
+	}
+
+	var uid string
+	var roles []string
+	if existing != nil {
+		uid = existing.UID
+		current, err := utils.GetUserRoles(uid)
+		if err != nil {
+			reopenInvitation(invitation.ID)
+			http.Error(w, "Failed to retrieve user details", http.StatusInternalServerError)
+			log.Printf("Failed to get user roles: %v\n", err)
+			return
+		}
+		roles = utils.MergeInvitedRoles(current, invitation.Roles)
+		if err := utils.SetUserRoles(uid, roles); err != nil {
+			reopenInvitation(invitation.ID)
+			http.Error(w, "Failed to assign role to user", http.StatusInternalServerError)
+			log.Printf("Failed to set user roles: %v\n", err)
+			return
+		}
+	} else {
+		roles = invitation.Roles
+		if uid, err = createInvitedUser(invitation, req.Name, req.Password); err != nil {
+			reopenInvitation(invitation.ID)
+			http.Error(w, "Failed to create account", http.StatusInternalServerError)
+			log.Printf("Failed to create invited user: %v\n", err)
+			return
+		}
+	}
+
+	if err := utils.SetInvitationAcceptedBy(invitation.ID, uid); err != nil {
+		log.Printf("Failed to record invitation acceptance: %v\n", err)
+	}
+
+	response := map[string]interface{}{
+		"uid":     uid,
+		"roles":   roles,
+		"created": existing == nil,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, "Failed to write response", http.StatusInternalServerError)
+		log.Printf("Failed to encode response: %v\n", err)
+	}
+}
+
+// reopenInvitation lets the invitee retry after setting up the account failed
+func reopenInvitation(id string) {
+	if err := utils.ReopenInvitation(id); err != nil {
+		log.Printf("Failed to reopen invitation: %v\n", err)
+	}
+}
+
+// createInvitedUser registers the invitee the way RegisterHandler does, but
+// with the invited roles and an already verified email. If a step after
+// creating the Firebase user fails, the user is deleted again.
+func createInvitedUser(invitation *utils.Invitation, name, password string) (string, error) {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+
+	params := (&auth.UserToCreate{}).
+		Email(invitation.Email).
+		EmailVerified(true).
+		Password(string(hashedPassword))
+	if name != "" {
+		params = params.DisplayName(name)
+	}
+	user, err := utils.FirebaseAuth.CreateUser(context.Background(), params)
+	if err != nil {
+		return "", err
+	}
+
+	if err := utils.StoreUserRoles(user.UID, utils.NewUserRoles(invitation.Roles...)); err != nil {
+		deleteNewUser(user.UID)
+		return "", err
+	}
+
+	data := map[string]interface{}{"hashed_password": string(hashedPassword)}
+	if name != "" {
+		data["name"] = name
+	}
+	if err := utils.FirebaseDB.NewRef("users/"+user.UID).Update(context.Background(), data); err != nil {
+		deleteNewUser(user.UID)
+		return "", err
+	}
+	return user.UID, nil
+}
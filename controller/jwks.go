@@ -0,0 +1,19 @@
+package controller
+
+import (
+	"backend/utils"
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// JWKSHandler publishes the public signing keys so other services can verify
+// our tokens without sharing a secret
+func JWKSHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{"keys": utils.PublicJWKS()}); err != nil {
+		log.Printf("Failed to encode response: %v\n", err)
+	}
+}
@@ -5,15 +5,70 @@ import (
 	"backend/utils"
 	"context"
 	"encoding/json"
+	"errors"
 	"log"
+	"net"
 	"net/http"
+	"strings"
+	"time"
 
+	"firebase.google.com/go/auth"
 	"golang.org/x/crypto/bcrypt"
 )
 
+// UserDetails holds the fields of users/{uid} needed to issue tokens
+type UserDetails struct {
+	HashedPassword string `json:"hashed_password"`
+	utils.UserRoles
+	TokenVersion int64 `json:"token_version"`
+}
+
+// credentialError is a failed credential check, with the status and message
+// the client should see
+type credentialError struct {
+	status  int
+	message string
+}
+
+// checkCredentials authenticates a user by email and password and returns the
+// Firebase user record and the user's details
+func checkCredentials(email, password string) (*auth.UserRecord, *UserDetails, *credentialError) {
+	// Authenticate user by email using Firebase Auth
+	u, err := utils.FirebaseAuth.GetUserByEmail(context.Background(), email)
+	if err != nil {
+		return nil, nil, &credentialError{http.StatusUnauthorized, "Invalid credentials"}
+	}
+
+	if !u.EmailVerified {
+		return nil, nil, &credentialError{http.StatusUnauthorized, "Email not verified"}
+	}
+
+	if u.Disabled {
+		return nil, nil, &credentialError{http.StatusForbidden, "Account disabled"}
+	}
+
+	// Retrieve user details (hashed_password, roles and token_version) in a single Firebase call
+	var userDetails UserDetails
+	err = utils.FirebaseDB.NewRef("users/"+u.UID).Get(context.Background(), &userDetails)
+	if err != nil || userDetails.HashedPassword == "" || userDetails.Role == "" {
+		return nil, nil, &credentialError{http.StatusInternalServerError, "Failed to retrieve user details"}
+	}
+
+	// Compare stored hashed password with the provided password
+	if err := bcrypt.CompareHashAndPassword([]byte(userDetails.HashedPassword), []byte(password)); err != nil {
+		return nil, nil, &credentialError{http.StatusUnauthorized, "Invalid credentials"}
+	}
+
+	return u, &userDetails, nil
+}
+
 // LoginHandler generates token and sends it to the client
 func LoginHandler(w http.ResponseWriter, r *http.Request) {
-	var user model.User
+	// Org optionally picks the organization to act in
+	var user struct {
+		model.User
+		Org string `json:"org"`
+	}
 	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
 		http.Error(w, "Bad Request", http.StatusBadRequest)
 		return
@@ -24,48 +79,102 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Authenticate user by email using Firebase Auth
-	u, err := utils.FirebaseAuth.GetUserByEmail(context.Background(), user.Email)
-	if err != nil {
-		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
-		return
-	}
-
-	if !u.EmailVerified {
-		http.Error(w, "Email not verified", http.StatusUnauthorized)
+	u, userDetails, credErr := checkCredentials(user.Email, user.Password)
+	if credErr != nil {
+		http.Error(w, credErr.message, credErr.status)
 		return
 	}
 
-	// Retrieve user details (hashed_password and role) in a single Firebase call
-	type UserDetails struct {
-		HashedPassword string `json:"hashed_password"`
-		Role           string `json:"role"`
+	var orgRoles []string
+	if user.Org != "" {
+		var err error
+		orgRoles, err = utils.OrgRolesFor(user.Org, u.UID)
+		if errors.Is(err, utils.ErrNotOrgMember) {
+			utils.Forbidden(w, "Not a member of the organization")
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to retrieve user details", http.StatusInternalServerError)
+			log.Printf("Failed to get org membership: %v\n", err)
+			return
+		}
 	}
 
-	var userDetails UserDetails
-	err = utils.FirebaseDB.NewRef("users/"+u.UID).Get(context.Background(), &userDetails)
-	if err != nil || userDetails.HashedPassword == "" || userDetails.Role == "" {
-		http.Error(w, "Failed to retrieve user details", http.StatusInternalServerError)
+	// Record the login as a session the user can see and end later
+	sessionID, err := utils.CreateSession(u.UID, r.UserAgent(), clientIP(r), user.Org)
+	if err != nil {
+		http.Error(w, "Failed to create session", http.StatusInternalServerError)
+		log.Printf("Failed to create session: %v\n", err)
 		return
 	}
 
-	// Compare stored hashed password with the provided password
-	if err := bcrypt.CompareHashAndPassword([]byte(userDetails.HashedPassword), []byte(user.Password)); err != nil {
-		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+	// Generate JWT token for the user with UID, role and session
+	token, err := utils.GenerateJWT(&utils.Claims{
+		UID:          u.UID,
+		UserRoles:    userDetails.UserRoles,
+		SID:          sessionID,
+		Org:          user.Org,
+		OrgRoles:     orgRoles,
+		Scope:        utils.DefaultScope(),
+		AuthTime:     time.Now().Unix(),
+		TokenVersion: userDetails.TokenVersion,
+	})
+	if err != nil {
+		http.Error(w, "Error generating token", http.StatusInternalServerError)
 		return
 	}
 
-	// Generate JWT token for the user with UID and role
-	token, err := utils.GenerateJWT(u.UID, userDetails.Role)
+	// Issue a refresh token so the client can renew the access token without the password
+	refreshToken, err := utils.IssueRefreshToken(u.UID, sessionID)
 	if err != nil {
 		http.Error(w, "Error generating token", http.StatusInternalServerError)
+		log.Printf("Failed to issue refresh token: %v\n", err)
 		return
 	}
 
+	writeTokenResponse(w, r, userDetails.Role, token, refreshToken)
+}
+
+// clientIP returns the address of the client, preferring the first hop of
+// X-Forwarded-For when running behind a proxy
+func clientIP(r *http.Request) string {
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+		first, _, _ := strings.Cut(forwarded, ",")
+		return strings.TrimSpace(first)
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// writeTokenResponse sends a freshly issued token pair to the client. Clients
+// in cookie session mode get the tokens as HttpOnly cookies instead, and only
+// the CSRF token in the body.
+func writeTokenResponse(w http.ResponseWriter, r *http.Request, role, token, refreshToken string) {
 	// Prepare response payload
 	response := map[string]interface{}{
-		"role":      userDetails.Role,
-		"jwt_token": token,
+		"role":          role,
+		"jwt_token":     token,
+		"token_type":    "Bearer",
+		"expires_in":    int(utils.AccessTokenTTL.Seconds()),
+		"refresh_token": refreshToken,
+	}
+
+	if utils.WantsCookies(r) {
+		csrfToken, err := utils.SetSessionCookies(w, token, refreshToken)
+		if err != nil {
+			http.Error(w, "Error generating token", http.StatusInternalServerError)
+			log.Printf("Failed to set session cookies: %v\n", err)
+			return
+		}
+		response = map[string]interface{}{
+			"role":       role,
+			"token_type": "cookie",
+			"expires_in": int(utils.AccessTokenTTL.Seconds()),
+			"csrf_token": csrfToken,
+		}
 	}
 
 	w.Header().Set("Content-Type", "application/json")
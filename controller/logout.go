@@ -0,0 +1,80 @@
+package controller
+
+import (
+	"backend/utils"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// LogoutRequest structure for the optional request body
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// LogoutHandler revokes the access token used for the request and ends its
+// session. A refresh token sent along is revoked as well.
+func LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*utils.Claims)
+
+	// A single Firebase ID token cannot be revoked on its own
+	if claims.Source == utils.TokenSourceFirebase {
+		http.Error(w, "Sign out with the Firebase SDK or use /user/logout-all", http.StatusBadRequest)
+		return
+	}
+	if claims.Source == utils.TokenSourceAPIKey {
+		http.Error(w, "API keys are revoked through /user/api-keys", http.StatusBadRequest)
+		return
+	}
+
+	// The body is optional, clients that only hold an access token may omit it
+	var req LogoutRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := utils.RevokeToken(claims); err != nil {
+		http.Error(w, "Failed to log out", http.StatusInternalServerError)
+		log.Printf("Failed to revoke token: %v\n", err)
+		return
+	}
+
+	if claims.SID != "" {
+		if err := utils.EndSession(claims.UID, claims.SID); err != nil {
+			http.Error(w, "Failed to log out", http.StatusInternalServerError)
+			log.Printf("Failed to end session: %v\n", err)
+			return
+		}
+	}
+
+	if req.RefreshToken != "" && strings.HasPrefix(req.RefreshToken, claims.UID+".") {
+		if err := utils.RevokeRefreshToken(req.RefreshToken); err != nil {
+			http.Error(w, "Failed to log out", http.StatusInternalServerError)
+			log.Printf("Failed to revoke refresh token: %v\n", err)
+			return
+		}
+	}
+
+	utils.ClearSessionCookies(w)
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("Logged out successfully"))
+}
+
+// LogoutAllHandler revokes every access and refresh token of the user
+func LogoutAllHandler(w http.ResponseWriter, r *http.Request) {
+	uid := r.Context().Value("uid").(string)
+
+	if err := utils.RevokeAllTokens(uid); err != nil {
+		http.Error(w, "Failed to log out", http.StatusInternalServerError)
+		log.Printf("Failed to revoke all tokens: %v\n", err)
+		return
+	}
+
+	utils.ClearSessionCookies(w)
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("Logged out from all devices successfully"))
+}
@@ -0,0 +1,130 @@
+package controller
+
+import (
+	"backend/utils"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+)
+
+// writeOAuthJSON sends a response in the format of the OAuth 2.0 endpoints,
+// which must never be cached
+func writeOAuthJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Printf("Failed to encode response: %v\n", err)
+	}
+}
+
+// writeOAuthError sends an RFC 6749 error response
+func writeOAuthError(w http.ResponseWriter, status int, code, description string) {
+	if status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+	}
+	writeOAuthJSON(w, status, map[string]string{
+		"error":             code,
+		"error_description": description,
+	})
+}
+
+// authenticateOAuthClient reads client credentials from HTTP Basic auth or,
+// failing that, from the client_id and client_secret form fields. It writes
+// the error response and returns nil if the client could not be authenticated.
+func authenticateOAuthClient(w http.ResponseWriter, r *http.Request) *utils.OAuthClient {
+	clientID, clientSecret, ok := r.BasicAuth()
+	if !ok {
+		clientID = r.PostFormValue("client_id")
+		clientSecret = r.PostFormValue("client_secret")
+	}
+
+	client, err := utils.AuthenticateClient(clientID, clientSecret)
+	if err != nil {
+		if errors.Is(err, utils.ErrClientInvalid) {
+			writeOAuthError(w, http.StatusUnauthorized, "invalid_client", "Client authentication failed")
+			return nil
+		}
+		writeOAuthError(w, http.StatusInternalServerError, "server_error", "Failed to authenticate client")
+		log.Printf("Failed to authenticate OAuth client: %v\n", err)
+		return nil
+	}
+	return client
+}
+
+// IntrospectHandler implements OAuth 2.0 token introspection (RFC 7662) for
+// our access tokens and API keys
+func IntrospectHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "Malformed request body")
+		return
+	}
+
+	client := authenticateOAuthClient(w, r)
+	if client == nil {
+		return
+	}
+	if !client.CanIntrospect {
+		writeOAuthError(w, http.StatusForbidden, "unauthorized_client", "Client may not introspect tokens")
+		return
+	}
+
+	token := r.PostFormValue("token")
+	if token == "" {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "token is required")
+		return
+	}
+
+	// Runs the same checks as AuthMiddleware, including revocation, without
+	// recording the check as a use of the token
+	claims, err := utils.Inspect(token)
+	if err != nil {
+		if errors.Is(err, utils.ErrTokenInvalid) || errors.Is(err, utils.ErrAPIKeyInvalid) ||
+			errors.Is(err, utils.ErrTokenRevoked) || errors.Is(err, utils.ErrSessionEnded) {
+			writeOAuthJSON(w, http.StatusOK, map[string]interface{}{"active": false})
+			return
+		}
+		writeOAuthError(w, http.StatusInternalServerError, "server_error", "Failed to introspect token")
+		log.Printf("Failed to introspect token: %v\n", err)
+		return
+	}
+
+	response := map[string]interface{}{
+		"active":     true,
+		"sub":        claims.UID,
+		"role":       claims.Role,
+		"token_type": "access_token",
+		"iat":        claims.IssuedAt,
+	}
+	if claims.Source == utils.TokenSourceAPIKey {
+		response["token_type"] = "api_key"
+	}
+	if len(claims.Roles) > 0 {
+		response["roles"] = claims.Roles
+	}
+	if claims.ExpiresAt != 0 {
+		response["exp"] = claims.ExpiresAt
+	}
+	if claims.Scope != "" {
+		response["scope"] = claims.Scope
+	}
+	if claims.Issuer != "" {
+		response["iss"] = claims.Issuer
+	}
+	if claims.Id != "" && claims.Source == "" {
+		response["jti"] = claims.Id
+	}
+	if claims.Act != nil {
+		response["act"] = claims.Act
+	}
+	if claims.ClientID != "" {
+		response["client_id"] = claims.ClientID
+	}
+	if claims.IsService() {
+		response["principal_type"] = utils.PrincipalService
+	}
+
+	writeOAuthJSON(w, http.StatusOK, response)
+}
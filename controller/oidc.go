@@ -0,0 +1,435 @@
+package controller
+
+import (
+	"backend/utils"
+	"context"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// scopeDescriptions are shown on the consent screen
+var scopeDescriptions = map[string]string{
+	utils.OIDCScopeOpenID:   "Sign you in with your account",
+	utils.OIDCScopeProfile:  "See your name and role",
+	utils.OIDCScopeEmail:    "See your email address",
+	utils.ScopeProfileRead:  "Read your profile",
+	utils.ScopeProfileWrite: "Update your profile",
+}
+
+var authorizeTemplate = template.Must(template.New("authorize").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Sign in to {{.ClientName}}</title></head>
+<body>
+	<h1>{{.ClientName}} wants to access your account</h1>
+	<p>It will be able to:</p>
+	<ul>{{range .Scopes}}<li>{{.}}</li>{{end}}</ul>
+	{{if .Error}}<p style="color: red">{{.Error}}</p>{{end}}
+	<form method="POST" action="/oauth/authorize">
+		{{range $name, $value := .Params}}<input type="hidden" name="{{$name}}" value="{{$value}}">
+		{{end}}
+		<p><label>Email <input type="email" name="email" value="{{.Email}}" required></label></p>
+		<p><label>Password <input type="password" name="password"></label></p>
+		<button type="submit" name="decision" value="allow">Allow</button>
+		<button type="submit" name="decision" value="deny" formnovalidate>Deny</button>
+	</form>
+</body>
+</html>
+`))
+
+var authorizeErrorTemplate = template.Must(template.New("authorize_error").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Authorization error</title></head>
+<body><h1>Authorization error</h1><p>{{.}}</p></body>
+</html>
+`))
+
+// authorizeRequest holds the parameters of an authorization request, which
+// are carried through the consent form in hidden fields
+type authorizeRequest struct {
+	client        *utils.OAuthClient
+	redirectURI   string
+	state         string
+	nonce         string
+	scope         string
+	codeChallenge string
+}
+
+// params returns the request parameters to embed in the consent form
+func (a *authorizeRequest) params() map[string]string {
+	return map[string]string{
+		"response_type":         "code",
+		"client_id":             a.client.ID,
+		"redirect_uri":          a.redirectURI,
+		"state":                 a.state,
+		"nonce":                 a.nonce,
+		"scope":                 a.scope,
+		"code_challenge":        a.codeChallenge,
+		"code_challenge_method": "S256",
+	}
+}
+
+// parseAuthorizeRequest validates an authorization request. Problems with the
+// client or redirect URI are shown to the user, anything else is reported back
+// to the client's redirect URI as RFC 6749 requires. It writes the response
+// and returns nil if the request cannot proceed.
+func parseAuthorizeRequest(w http.ResponseWriter, r *http.Request) *authorizeRequest {
+	client, err := utils.GetOAuthClient(r.FormValue("client_id"))
+	if err != nil {
+		renderAuthorizeError(w, http.StatusInternalServerError, "Failed to look up the application")
+		log.Printf("Failed to get OAuth client: %v\n", err)
+		return nil
+	}
+	if client == nil || !client.AllowsGrant(utils.GrantAuthorizationCode) {
+		renderAuthorizeError(w, http.StatusBadRequest, "Unknown application")
+		return nil
+	}
+
+	redirectURI := r.FormValue("redirect_uri")
+	if !client.HasRedirectURI(redirectURI) {
+		renderAuthorizeError(w, http.StatusBadRequest, "The redirect URI is not registered for this application")
+		return nil
+	}
+
+	req := &authorizeRequest{
+		client:        client,
+		redirectURI:   redirectURI,
+		state:         r.FormValue("state"),
+		nonce:         r.FormValue("nonce"),
+		codeChallenge: r.FormValue("code_challenge"),
+	}
+
+	if r.FormValue("response_type") != "code" {
+		redirectAuthorizeError(w, r, req, "unsupported_response_type", "Only the code response type is supported")
+		return nil
+	}
+	if req.codeChallenge == "" || r.FormValue("code_challenge_method") != "S256" {
+		redirectAuthorizeError(w, r, req, "invalid_request", "PKCE with code_challenge_method S256 is required")
+		return nil
+	}
+
+	apiScopes, oidcScopes := utils.SplitScope(r.FormValue("scope"))
+	if len(apiScopes)+len(oidcScopes) == 0 {
+		redirectAuthorizeError(w, r, req, "invalid_scope", "No supported scope was requested")
+		return nil
+	}
+	req.scope = strings.Join(append(oidcScopes, apiScopes...), " ")
+
+	return req
+}
+
+func renderAuthorizeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	if err := authorizeErrorTemplate.Execute(w, message); err != nil {
+		log.Printf("Failed to render authorization error: %v\n", err)
+	}
+}
+
+func renderAuthorizeForm(w http.ResponseWriter, req *authorizeRequest, email, message string) {
+	scopes := []string{}
+	for _, s := range strings.Fields(req.scope) {
+		scopes = append(scopes, scopeDescriptions[s])
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	// The consent screen must not be framed by another site
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Content-Security-Policy", "frame-ancestors 'none'")
+	w.WriteHeader(http.StatusOK)
+	err := authorizeTemplate.Execute(w, map[string]interface{}{
+		"ClientName": req.client.Name,
+		"Scopes":     scopes,
+		"Params":     req.params(),
+		"Email":      email,
+		"Error":      message,
+	})
+	if err != nil {
+		log.Printf("Failed to render authorization form: %v\n", err)
+	}
+}
+
+// redirectAuthorize sends the user back to the client with the given parameters
+func redirectAuthorize(w http.ResponseWriter, r *http.Request, req *authorizeRequest, params url.Values) {
+	target, err := url.Parse(req.redirectURI)
+	if err != nil {
+		renderAuthorizeError(w, http.StatusBadRequest, "The redirect URI is invalid")
+		return
+	}
+
+	query := target.Query()
+	for name, values := range params {
+		query[name] = values
+	}
+	if req.state != "" {
+		query.Set("state", req.state)
+	}
+	target.RawQuery = query.Encode()
+
+	http.Redirect(w, r, target.String(), http.StatusFound)
+}
+
+func redirectAuthorizeError(w http.ResponseWriter, r *http.Request, req *authorizeRequest, code, description string) {
+	redirectAuthorize(w, r, req, url.Values{
+		"error":             {code},
+		"error_description": {description},
+	})
+}
+
+// AuthorizeHandler shows the sign-in and consent screen of the authorization
+// code flow
+func AuthorizeHandler(w http.ResponseWriter, r *http.Request) {
+	req := parseAuthorizeRequest(w, r)
+	if req == nil {
+		return
+	}
+	renderAuthorizeForm(w, req, "", "")
+}
+
+// AuthorizeSubmitHandler checks the credentials entered on the consent screen
+// and redirects back to the client with an authorization code
+func AuthorizeSubmitHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		renderAuthorizeError(w, http.StatusBadRequest, "Malformed request")
+		return
+	}
+
+	req := parseAuthorizeRequest(w, r)
+	if req == nil {
+		return
+	}
+
+	if r.PostFormValue("decision") != "allow" {
+		redirectAuthorizeError(w, r, req, "access_denied", "The user denied the request")
+		return
+	}
+
+	// Same credential check as LoginHandler
+	email := r.PostFormValue("email")
+	u, _, credErr := checkCredentials(email, r.PostFormValue("password"))
+	if credErr != nil {
+		renderAuthorizeForm(w, req, email, credErr.message)
+		return
+	}
+
+	code, err := utils.CreateAuthorizationCode(&utils.AuthorizationCode{
+		ClientID:      req.client.ID,
+		UID:           u.UID,
+		RedirectURI:   req.redirectURI,
+		Scope:         req.scope,
+		Nonce:         req.nonce,
+		CodeChallenge: req.codeChallenge,
+		AuthTime:      time.Now().Unix(),
+	})
+	if err != nil {
+		redirectAuthorizeError(w, r, req, "server_error", "Failed to issue an authorization code")
+		log.Printf("Failed to create authorization code: %v\n", err)
+		return
+	}
+
+	redirectAuthorize(w, r, req, url.Values{"code": {code}})
+}
+
+// authenticateTokenClient authenticates the caller of the token endpoint.
+// Public clients only send their client_id. It writes the error response and
+// returns nil if the client could not be authenticated.
+func authenticateTokenClient(w http.ResponseWriter, r *http.Request) *utils.OAuthClient {
+	if _, _, ok := r.BasicAuth(); !ok && r.PostFormValue("client_secret") == "" {
+		client, err := utils.GetOAuthClient(r.PostFormValue("client_id"))
+		if err != nil {
+			writeOAuthError(w, http.StatusInternalServerError, "server_error", "Failed to authenticate client")
+			log.Printf("Failed to get OAuth client: %v\n", err)
+			return nil
+		}
+		if client == nil || !client.Public {
+			writeOAuthError(w, http.StatusUnauthorized, "invalid_client", "Client authentication failed")
+			return nil
+		}
+		return client
+	}
+	return authenticateOAuthClient(w, r)
+}
+
+// TokenHandler is the OAuth 2.0 token endpoint
+func TokenHandler(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_request", "Malformed request body")
+		return
+	}
+
+	client := authenticateTokenClient(w, r)
+	if client == nil {
+		return
+	}
+
+	grantType := r.PostFormValue("grant_type")
+	if !client.AllowsGrant(grantType) {
+		writeOAuthError(w, http.StatusBadRequest, "unauthorized_client", "Client may not use this grant type")
+		return
+	}
+
+	switch grantType {
+	case utils.GrantAuthorizationCode:
+		exchangeAuthorizationCode(w, r, client)
+	case utils.GrantClientCredentials:
+		issueClientCredentialsToken(w, r, client)
+	default:
+		writeOAuthError(w, http.StatusBadRequest, "unsupported_grant_type", "Unsupported grant type")
+	}
+}
+
+// exchangeAuthorizationCode redeems an authorization code for an access token
+// and, for the openid scope, an ID token
+func exchangeAuthorizationCode(w http.ResponseWriter, r *http.Request, client *utils.OAuthClient) {
+	grant, err := utils.ConsumeAuthorizationCode(r.PostFormValue("code"))
+	if err != nil {
+		if errors.Is(err, utils.ErrAuthorizationCodeInvalid) {
+			writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "Invalid or expired authorization code")
+			return
+		}
+		writeOAuthError(w, http.StatusInternalServerError, "server_error", "Failed to redeem authorization code")
+		log.Printf("Failed to consume authorization code: %v\n", err)
+		return
+	}
+
+	if grant.ClientID != client.ID || grant.RedirectURI != r.PostFormValue("redirect_uri") {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "Authorization code was issued for another client or redirect URI")
+		return
+	}
+	if !utils.VerifyPKCE(r.PostFormValue("code_verifier"), grant.CodeChallenge) {
+		writeOAuthError(w, http.StatusBadRequest, "invalid_grant", "PKCE verification failed")
+		return
+	}
+
+	// Read the current role and token version, they may have changed since consent
+	var userDetails UserDetails
+	err = utils.FirebaseDB.NewRef("users/"+grant.UID).Get(context.Background(), &userDetails)
+	if err != nil || userDetails.Role == "" {
+		writeOAuthError(w, http.StatusInternalServerError, "server_error", "Failed to retrieve user details")
+		return
+	}
+
+	// The token only carries the profile and OpenID Connect scopes the user
+	// consented to. It has no auth_time: consenting is not entering the
+	// password for this token, so it must not pass RequireRecentAuth.
+	apiScopes, oidcScopes := utils.SplitScope(grant.Scope)
+	scope := strings.Join(append(oidcScopes, apiScopes...), " ")
+	accessToken, err := utils.GenerateJWT(&utils.Claims{
+		UID:          grant.UID,
+		UserRoles:    userDetails.UserRoles,
+		Scope:        scope,
+		ClientID:     client.ID,
+		TokenVersion: userDetails.TokenVersion,
+	})
+	if err != nil {
+		writeOAuthError(w, http.StatusInternalServerError, "server_error", "Error generating token")
+		return
+	}
+
+	response := map[string]interface{}{
+		"access_token": accessToken,
+		"token_type":   "Bearer",
+		"expires_in":   int(utils.AccessTokenTTL.Seconds()),
+		"scope":        scope,
+	}
+
+	scopes := &utils.Claims{Scope: scope}
+	if scopes.HasScope(utils.OIDCScopeOpenID) {
+		idClaims, err := userInfoClaims(grant.UID, userDetails.Role, scopes)
+		if err != nil {
+			writeOAuthError(w, http.StatusInternalServerError, "server_error", "Failed to retrieve user details")
+			log.Printf("Failed to build ID token claims: %v\n", err)
+			return
+		}
+		idClaims.AuthTime = grant.AuthTime
+		idClaims.Nonce = grant.Nonce
+
+		idToken, err := utils.GenerateIDToken(client.ID, grant.UID, idClaims)
+		if err != nil {
+			writeOAuthError(w, http.StatusInternalServerError, "server_error", "Error generating token")
+			return
+		}
+		response["id_token"] = idToken
+	}
+
+	writeOAuthJSON(w, http.StatusOK, response)
+}
+
+// userInfoClaims collects the user claims released for the granted scopes
+func userInfoClaims(uid, role string, scopes *utils.Claims) (*utils.IDTokenClaims, error) {
+	claims := &utils.IDTokenClaims{Role: role}
+
+	if scopes.HasScope(utils.OIDCScopeEmail) {
+		u, err := utils.FirebaseAuth.GetUser(context.Background(), uid)
+		if err != nil {
+			return nil, err
+		}
+		claims.Email = u.Email
+		claims.EmailVerified = u.EmailVerified
+	}
+
+	if scopes.HasScope(utils.OIDCScopeProfile) {
+		if err := utils.FirebaseDB.NewRef("users/"+uid+"/name").Get(context.Background(), &claims.Name); err != nil {
+			return nil, err
+		}
+	}
+
+	return claims, nil
+}
+
+// UserInfoHandler is the OpenID Connect userinfo endpoint
+func UserInfoHandler(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*utils.Claims)
+
+	info, err := userInfoClaims(claims.UID, claims.Role, claims)
+	if err != nil {
+		http.Error(w, "Failed to retrieve user details", http.StatusInternalServerError)
+		log.Printf("Failed to build userinfo claims: %v\n", err)
+		return
+	}
+	info.Subject = claims.UID
+
+	writeOAuthJSON(w, http.StatusOK, info)
+}
+
+// OpenIDConfigurationHandler publishes the OpenID Connect discovery document
+func OpenIDConfigurationHandler(w http.ResponseWriter, r *http.Request) {
+	issuer := utils.Issuer()
+
+	scopes := append([]string{}, utils.OIDCScopes...)
+	for _, s := range utils.KnownScopes {
+		if utils.IsDelegableScope(s) {
+			scopes = append(scopes, s)
+		}
+	}
+
+	configuration := map[string]interface{}{
+		"issuer":                                issuer,
+		"authorization_endpoint":                issuer + "/oauth/authorize",
+		"token_endpoint":                        issuer + "/oauth/token",
+		"userinfo_endpoint":                     issuer + "/oauth/userinfo",
+		"introspection_endpoint":                issuer + "/oauth/introspect",
+		"jwks_uri":                              issuer + "/.well-known/jwks.json",
+		"response_types_supported":              []string{"code"},
+		"grant_types_supported":                 []string{utils.GrantAuthorizationCode, utils.GrantClientCredentials},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{utils.SigningAlg()},
+		"scopes_supported":                      scopes,
+		"token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post", "none"},
+		"code_challenge_methods_supported":      []string{"S256"},
+		"claims_supported":                      []string{"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce", "role", "email", "email_verified", "name"},
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(configuration); err != nil {
+		log.Printf("Failed to encode response: %v\n", err)
+	}
+}
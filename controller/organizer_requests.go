@@ -0,0 +1,105 @@
+package controller
+
+import (
+	"backend/utils"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+
+	"github.com/gorilla/mux"
+)
+
+// ListOrganizerRequestsHandler shows the organizer approvals queue, oldest
+// first. ?status=approved or rejected shows reviewed requests instead.
+func ListOrganizerRequestsHandler(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "":
+		status = utils.OrganizerRequestPending
+	case utils.OrganizerRequestPending, utils.OrganizerRequestApproved, utils.OrganizerRequestRejected:
+	default:
+		http.Error(w, "status must be pending, approved or rejected", http.StatusBadRequest)
+		return
+	}
+
+	requests, err := utils.ListOrganizerRequests(status)
+	if err != nil {
+		http.Error(w, "Failed to retrieve organizer requests", http.StatusInternalServerError)
+		log.Printf("Failed to list organizer requests: %v\n", err)
+		return
+	}
+	sort.Slice(requests, func(i, j int) bool { return requests[i].RequestedAt < requests[j].RequestedAt })
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(requests); err != nil {
+		http.Error(w, "Failed to write response", http.StatusInternalServerError)
+		log.Printf("Failed to encode response: %v\n", err)
+	}
+}
+
+// ApproveOrganizerRequestHandler makes the applicant an organizer
+func ApproveOrganizerRequestHandler(w http.ResponseWriter, r *http.Request) {
+	reviewOrganizerRequest(w, r, true)
+}
+
+// RejectOrganizerRequestHandler leaves the applicant a regular user
+func RejectOrganizerRequestHandler(w http.ResponseWriter, r *http.Request) {
+	reviewOrganizerRequest(w, r, false)
+}
+
+func reviewOrganizerRequest(w http.ResponseWriter, r *http.Request, approve bool) {
+	uid := mux.Vars(r)["uid"]
+
+	// The reason is optional and included in the email to the applicant
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+	}
+
+	existing, err := utils.GetOrganizerRequest(uid)
+	if err != nil {
+		http.Error(w, "Failed to retrieve organizer request", http.StatusInternalServerError)
+		log.Printf("Failed to get organizer request: %v\n", err)
+		return
+	}
+	if existing == nil {
+		http.Error(w, "Organizer request not found", http.StatusNotFound)
+		return
+	}
+
+	request, err := utils.ReviewOrganizerRequest(uid, r.Context().Value("uid").(string), approve, req.Reason)
+	if errors.Is(err, utils.ErrOrganizerRequestReviewed) {
+		http.Error(w, "Organizer request has already been reviewed", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to review organizer request", http.StatusInternalServerError)
+		log.Printf("Failed to review organizer request: %v\n", err)
+		return
+	}
+
+	// The decision stands even if the applicant cannot be told about it
+	emailSent := true
+	if err := utils.SendOrganizerDecisionEmail(request.Email, approve, request.Reason); err != nil {
+		emailSent = false
+		log.Printf("Failed to send organizer decision email: %v\n", err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"request":    request,
+		"email_sent": emailSent,
+	}); err != nil {
+		http.Error(w, "Failed to write response", http.StatusInternalServerError)
+		log.Printf("Failed to encode response: %v\n", err)
+	}
+}
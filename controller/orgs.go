@@ -0,0 +1,283 @@
+package controller
+
+import (
+	"backend/utils"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// OrgMembership is one of the caller's organizations
+type OrgMembership struct {
+	utils.Org
+	Roles  []string `json:"roles"`
+	Active bool     `json:"active"`
+}
+
+// ListMyOrgsHandler lists the organizations the caller belongs to
+func ListMyOrgsHandler(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*utils.Claims)
+
+	ids, err := utils.ListUserOrgs(claims.UID)
+	if err != nil {
+		http.Error(w, "Failed to retrieve organizations", http.StatusInternalServerError)
+		log.Printf("Failed to list user orgs: %v\n", err)
+		return
+	}
+
+	orgs := make([]OrgMembership, 0, len(ids))
+	for _, id := range ids {
+		org, err := utils.GetOrg(id)
+		if err == nil && org != nil {
+			var member *utils.OrgMember
+			if member, err = utils.GetOrgMember(id, claims.UID); err == nil && member != nil {
+				orgs = append(orgs, OrgMembership{Org: *org, Roles: member.Roles, Active: id == claims.Org})
+			}
+		}
+		if err != nil {
+			http.Error(w, "Failed to retrieve organizations", http.StatusInternalServerError)
+			log.Printf("Failed to get org: %v\n", err)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(orgs); err != nil {
+		http.Error(w, "Failed to write response", http.StatusInternalServerError)
+		log.Printf("Failed to encode response: %v\n", err)
+	}
+}
+
+// SelectOrgRequest structure for the request body
+type SelectOrgRequest struct {
+	Org string `json:"org"` // empty to act outside of any organization
+}
+
+// SelectOrgHandler switches the organization the caller acts in. It returns
+// a token for the org and makes it the session's active org, so refreshed
+// tokens (and cookie sessions, after a refresh) keep it.
+func SelectOrgHandler(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*utils.Claims)
+
+	if claims.Source != "" || claims.Act != nil {
+		utils.Forbidden(w, "Organizations can only be selected with an access token")
+		return
+	}
+
+	var req SelectOrgRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	var orgRoles []string
+	if req.Org != "" {
+		var err error
+		orgRoles, err = utils.OrgRolesFor(req.Org, claims.UID)
+		if errors.Is(err, utils.ErrNotOrgMember) {
+			utils.Forbidden(w, "Not a member of the organization")
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to retrieve organization", http.StatusInternalServerError)
+			log.Printf("Failed to get org membership: %v\n", err)
+			return
+		}
+	}
+
+	if claims.SID != "" {
+		if err := utils.SetSessionOrg(claims.UID, claims.SID, req.Org); err != nil {
+			http.Error(w, "Failed to update session", http.StatusInternalServerError)
+			log.Printf("Failed to set session org: %v\n", err)
+			return
+		}
+	}
+
+	token, err := utils.GenerateJWT(&utils.Claims{
+		UID:          claims.UID,
+		UserRoles:    claims.UserRoles,
+		SID:          claims.SID,
+		Org:          req.Org,
+		OrgRoles:     orgRoles,
+		Scope:        claims.Scope,
+		ClientID:     claims.ClientID,
+		Act:          claims.Act,
+		AuthTime:     claims.AuthTime,
+		TokenVersion: claims.TokenVersion,
+	})
+	if err != nil {
+		http.Error(w, "Error generating token", http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]interface{}{
+		"jwt_token":  token,
+		"token_type": "Bearer",
+		"expires_in": int(utils.AccessTokenTTL.Seconds()),
+		"org":        req.Org,
+		"org_roles":  orgRoles,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, "Failed to write response", http.StatusInternalServerError)
+		log.Printf("Failed to encode response: %v\n", err)
+	}
+}
+
+// CreateOrgHandler creates an organization with the caller as its admin
+func CreateOrgHandler(w http.ResponseWriter, r *http.Request) {
+	uid := r.Context().Value("uid").(string)
+
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+	if req.Name == "" {
+		http.Error(w, "Name is required", http.StatusBadRequest)
+		return
+	}
+
+	org, err := utils.CreateOrg(req.Name, uid)
+	if err != nil {
+		http.Error(w, "Failed to create organization", http.StatusInternalServerError)
+		log.Printf("Failed to create org: %v\n", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	if err := json.NewEncoder(w).Encode(org); err != nil {
+		http.Error(w, "Failed to write response", http.StatusInternalServerError)
+		log.Printf("Failed to encode response: %v\n", err)
+	}
+}
+
+// ListOrgMembersHandler lists the members of the caller's active org
+func ListOrgMembersHandler(w http.ResponseWriter, r *http.Request) {
+	org := r.Context().Value("org").(string)
+
+	members, err := utils.ListOrgMembers(org)
+	if err != nil {
+		http.Error(w, "Failed to retrieve members", http.StatusInternalServerError)
+		log.Printf("Failed to list org members: %v\n", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(members); err != nil {
+		http.Error(w, "Failed to write response", http.StatusInternalServerError)
+		log.Printf("Failed to encode response: %v\n", err)
+	}
+}
+
+// SetOrgMemberHandler changes a member's roles in the caller's active org.
+// Adding users who are not members yet takes the global users:manage
+// permission, since they have not agreed to join.
+func SetOrgMemberHandler(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*utils.Claims)
+	org := claims.Org
+	uid := mux.Vars(r)["uid"]
+
+	var req struct {
+		Roles []string `json:"roles"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+	if err := utils.ValidateRoles(req.Roles, false); err != nil {
+		http.Error(w, "Invalid roles: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	member, err := utils.GetOrgMember(org, uid)
+	if err != nil {
+		http.Error(w, "Failed to retrieve member", http.StatusInternalServerError)
+		log.Printf("Failed to get org member: %v\n", err)
+		return
+	}
+
+	if member == nil {
+		if !claims.HasPermission(utils.PermissionManageUsers) {
+			utils.Forbidden(w, "Only platform admins can add users who are not members yet")
+			return
+		}
+		roles, err := utils.GetUserRoles(uid)
+		if err != nil {
+			http.Error(w, "Failed to retrieve user", http.StatusInternalServerError)
+			log.Printf("Failed to get user roles: %v\n", err)
+			return
+		}
+		if roles.Role == "" {
+			http.Error(w, "User not found", http.StatusNotFound)
+			return
+		}
+	} else {
+		err = utils.CheckOrgKeepsAdmin(org, uid, req.Roles)
+		if errors.Is(err, utils.ErrLastOrgAdmin) {
+			http.Error(w, "The organization needs at least one admin", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			http.Error(w, "Failed to retrieve members", http.StatusInternalServerError)
+			log.Printf("Failed to list org members: %v\n", err)
+			return
+		}
+	}
+
+	if err := utils.SetOrgMember(org, uid, req.Roles); err != nil {
+		http.Error(w, "Failed to update member", http.StatusInternalServerError)
+		log.Printf("Failed to set org member: %v\n", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("Member updated successfully"))
+}
+
+// RemoveOrgMemberHandler removes a user from the caller's active org
+func RemoveOrgMemberHandler(w http.ResponseWriter, r *http.Request) {
+	org := r.Context().Value("org").(string)
+	uid := mux.Vars(r)["uid"]
+
+	member, err := utils.GetOrgMember(org, uid)
+	if err != nil {
+		http.Error(w, "Failed to retrieve member", http.StatusInternalServerError)
+		log.Printf("Failed to get org member: %v\n", err)
+		return
+	}
+	if member == nil {
+		http.Error(w, "Member not found", http.StatusNotFound)
+		return
+	}
+
+	err = utils.CheckOrgKeepsAdmin(org, uid, nil)
+	if errors.Is(err, utils.ErrLastOrgAdmin) {
+		http.Error(w, "The organization needs at least one admin", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to retrieve members", http.StatusInternalServerError)
+		log.Printf("Failed to list org members: %v\n", err)
+		return
+	}
+
+	if err := utils.RemoveOrgMember(org, uid); err != nil {
+		http.Error(w, "Failed to remove member", http.StatusInternalServerError)
+		log.Printf("Failed to remove org member: %v\n", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("Member removed successfully"))
+}
@@ -0,0 +1,91 @@
+package controller
+
+import (
+	"backend/utils"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+)
+
+// ReauthRequest structure for the request body
+type ReauthRequest struct {
+	Password string `json:"password"`
+}
+
+// ReauthHandler checks the user's password again and issues a short-lived
+// token with a fresh auth_time, as required by sensitive operations
+func ReauthHandler(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*utils.Claims)
+
+	if claims.Source == utils.TokenSourceAPIKey {
+		utils.Forbidden(w, "API keys cannot re-authenticate")
+		return
+	}
+	if claims.Act != nil {
+		utils.Forbidden(w, "Impersonation tokens cannot re-authenticate")
+		return
+	}
+
+	var req ReauthRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	if req.Password == "" {
+		http.Error(w, "Password is required", http.StatusBadRequest)
+		return
+	}
+
+	if err := utils.CheckPassword(claims.UID, req.Password); err != nil {
+		if errors.Is(err, utils.ErrInvalidCredentials) {
+			http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+			return
+		}
+		http.Error(w, "Failed to retrieve user details", http.StatusInternalServerError)
+		log.Printf("Failed to check password: %v\n", err)
+		return
+	}
+
+	// Firebase ID tokens carry no token version, look up the current one
+	tokenVersion := claims.TokenVersion
+	if claims.Source == utils.TokenSourceFirebase {
+		var err error
+		if tokenVersion, err = utils.GetTokenVersion(claims.UID); err != nil {
+			http.Error(w, "Failed to retrieve user details", http.StatusInternalServerError)
+			log.Printf("Failed to get token version: %v\n", err)
+			return
+		}
+	}
+
+	token, err := utils.GenerateJWTWithTTL(&utils.Claims{
+		UID:          claims.UID,
+		UserRoles:    claims.UserRoles,
+		Org:          claims.Org,
+		OrgRoles:     claims.OrgRoles,
+		SID:          claims.SID,
+		Scope:        claims.Scope,
+		ClientID:     claims.ClientID,
+		AuthTime:     time.Now().Unix(),
+		TokenVersion: tokenVersion,
+	}, utils.ElevatedTokenTTL)
+	if err != nil {
+		http.Error(w, "Error generating token", http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]interface{}{
+		"jwt_token":  token,
+		"token_type": "Bearer",
+		"expires_in": int(utils.ElevatedTokenTTL.Seconds()),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, "Failed to write response", http.StatusInternalServerError)
+		log.Printf("Failed to encode response: %v\n", err)
+	}
+}
@@ -0,0 +1,95 @@
+package controller
+
+import (
+	"backend/utils"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+)
+
+// RefreshTokenRequest structure for the request body
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// RefreshTokenHandler exchanges a refresh token for a new access token and a
+// rotated refresh token
+func RefreshTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var req RefreshTokenRequest
+	if cookie, err := r.Cookie(utils.RefreshTokenCookie); err == nil && cookie.Value != "" && utils.CookieModeEnabled() {
+		// Cookie session mode, the CSRF token proves the request is not cross-site
+		if !utils.ValidCSRF(r) {
+			utils.Forbidden(w, "Invalid or missing CSRF token")
+			return
+		}
+		req.RefreshToken = cookie.Value
+	} else if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.RefreshToken == "" {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	uid, sessionID, refreshToken, err := utils.RotateRefreshToken(req.RefreshToken)
+	if err != nil {
+		if errors.Is(err, utils.ErrRefreshTokenInvalid) || errors.Is(err, utils.ErrRefreshTokenReused) {
+			http.Error(w, "Invalid or expired refresh token", http.StatusUnauthorized)
+			return
+		}
+		http.Error(w, "Failed to refresh token", http.StatusInternalServerError)
+		log.Printf("Failed to rotate refresh token: %v\n", err)
+		return
+	}
+
+	// The session may have been ended from another device
+	session, err := utils.GetSession(uid, sessionID)
+	if err != nil {
+		http.Error(w, "Failed to refresh token", http.StatusInternalServerError)
+		log.Printf("Failed to check session: %v\n", err)
+		return
+	}
+	if session == nil {
+		http.Error(w, "Session has ended", http.StatusUnauthorized)
+		return
+	}
+
+	// Look up the current roles and token version so account changes are picked up on refresh
+	var userDetails UserDetails
+	err = utils.FirebaseDB.NewRef("users/"+uid).Get(context.Background(), &userDetails)
+	if err != nil || userDetails.Role == "" {
+		http.Error(w, "Failed to retrieve user details", http.StatusInternalServerError)
+		return
+	}
+
+	// Carry over the session's org, unless the user has left it meanwhile
+	var orgRoles []string
+	if session.Org != "" {
+		orgRoles, err = utils.OrgRolesFor(session.Org, uid)
+		if errors.Is(err, utils.ErrNotOrgMember) {
+			session.Org = ""
+			err = utils.SetSessionOrg(uid, sessionID, "")
+		}
+		if err != nil {
+			http.Error(w, "Failed to retrieve user details", http.StatusInternalServerError)
+			log.Printf("Failed to check org membership: %v\n", err)
+			return
+		}
+	}
+
+	token, err := utils.GenerateJWT(&utils.Claims{
+		UID:          uid,
+		UserRoles:    userDetails.UserRoles,
+		SID:          sessionID,
+		Org:          session.Org,
+		OrgRoles:     orgRoles,
+		Scope:        utils.DefaultScope(),
+		AuthTime:     session.CreatedAt, // refreshing does not count as authenticating
+		TokenVersion: userDetails.TokenVersion,
+	})
+	if err != nil {
+		http.Error(w, "Error generating token", http.StatusInternalServerError)
+		return
+	}
+
+	writeTokenResponse(w, r, userDetails.Role, token, refreshToken)
+}
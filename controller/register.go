@@ -19,11 +19,29 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Ensure that the role is not empty
-	if user.Role == "" {
+	// Ensure that the role is not empty; roles takes precedence over role
+	roles := utils.NewUserRoles(user.Roles...)
+	if len(user.Roles) == 0 {
+		roles = utils.NewUserRoles(user.Role)
+	}
+	if roles.Role == "" {
 		http.Error(w, "Role is required", http.StatusBadRequest)
 		return
 	}
+	if err := utils.ValidateRoles(roles.Roles, true); err != nil {
+		http.Error(w, "Invalid roles: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Organizers start out as pending_organizer until an admin approves them
+	organizerRequested := false
+	for i, role := range roles.Roles {
+		if role == utils.RoleOrganizer {
+			roles.Roles[i] = utils.RolePendingOrganizer
+			organizerRequested = true
+		}
+	}
+	roles.Role = roles.Roles[0]
 
 	// Hash the password
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
@@ -33,11 +51,13 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Create the Firebase user
+	// Create the Firebase user; the roles go into custom claims below
 	params := (&auth.UserToCreate{}).
 		Email(user.Email).
-		Password(string(hashedPassword)).
-		DisplayName(user.Role) // Ensure role is passed here as the DisplayName
+		Password(string(hashedPassword))
+	if user.Name != "" {
+		params = params.DisplayName(user.Name)
+	}
 
 	// We do NOT create the user yet, we'll do it after email verification
 	// Send verification email first
@@ -68,9 +88,10 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 	verificationEmailSent = true
 
 	if verificationEmailSent {
-		// Assign role to the user in Firebase Database
-		err = utils.FirebaseDB.NewRef("users/"+newUser.UID+"/role").Set(context.Background(), user.Role)
+		// Assign roles to the user in Firebase Database and custom claims
+		err = utils.StoreUserRoles(newUser.UID, roles)
 		if err != nil {
+			deleteNewUser(newUser.UID)
 			http.Error(w, "Failed to assign role to user", http.StatusInternalServerError)
 			log.Printf("Failed to assign role to user: %v\n", err)
 			return
@@ -79,10 +100,22 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 		// Save hashed password in Firebase Database
 		err = utils.FirebaseDB.NewRef("users/"+newUser.UID+"/hashed_password").Set(context.Background(), string(hashedPassword))
 		if err != nil {
+			deleteNewUser(newUser.UID)
 			http.Error(w, "Failed to save user password", http.StatusInternalServerError)
 			log.Printf("Failed to save user password: %v\n", err)
 			return
 		}
+
+		// Queue the organizer request for review
+		if organizerRequested {
+			err = utils.CreateOrganizerRequest(newUser.UID, user.Email, user.Name)
+			if err != nil {
+				deleteNewUser(newUser.UID)
+				http.Error(w, "Failed to submit organizer request", http.StatusInternalServerError)
+				log.Printf("Failed to create organizer request: %v\n", err)
+				return
+			}
+		}
 	}
 
 	// Respond with a message asking the user to check their email
@@ -90,6 +123,17 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 	w.Write([]byte("User registered successfully. Please check your email to verify your account"))
 }
 
+// deleteNewUser removes an account whose registration failed halfway, so the
+// email address can be used to register again
+func deleteNewUser(uid string) {
+	if err := utils.FirebaseAuth.DeleteUser(context.Background(), uid); err != nil {
+		log.Printf("Failed to delete incomplete user: %v\n", err)
+	}
+	if err := utils.FirebaseDB.NewRef("users/" + uid).Delete(context.Background()); err != nil {
+		log.Printf("Failed to delete incomplete user data: %v\n", err)
+	}
+}
+
 // package controller
 
 // import (
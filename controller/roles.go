@@ -0,0 +1,19 @@
+package controller
+
+import (
+	"backend/utils"
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// ListRolesHandler lists the roles of the role registry, so signup forms can
+// offer the self-assignable ones by their display names
+func ListRolesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(utils.ListRoles()); err != nil {
+		http.Error(w, "Failed to write response", http.StatusInternalServerError)
+		log.Printf("Failed to encode response: %v\n", err)
+	}
+}
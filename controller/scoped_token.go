@@ -0,0 +1,76 @@
+package controller
+
+import (
+	"backend/utils"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// ScopedTokenRequest structure for the request body
+type ScopedTokenRequest struct {
+	Scope string `json:"scope"` // space separated, e.g. "profile:read"
+}
+
+// ScopedTokenHandler mints an access token restricted to a subset of the
+// caller's scopes, e.g. a read-only profile token for a partner widget. The
+// token belongs to the caller's session and ends with it.
+func ScopedTokenHandler(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*utils.Claims)
+
+	if claims.Source != "" || claims.Act != nil {
+		utils.Forbidden(w, "Scoped tokens can only be minted from an access token")
+		return
+	}
+
+	var req ScopedTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	scopes := strings.Fields(req.Scope)
+	if len(scopes) == 0 {
+		http.Error(w, "Scope is required", http.StatusBadRequest)
+		return
+	}
+	for _, scope := range scopes {
+		if !claims.HasScope(scope) {
+			utils.Forbidden(w, "Cannot grant a scope the token does not have: "+scope)
+			return
+		}
+	}
+
+	scope := strings.Join(scopes, " ")
+	token, err := utils.GenerateJWT(&utils.Claims{
+		UID:          claims.UID,
+		UserRoles:    claims.UserRoles,
+		Org:          claims.Org,
+		OrgRoles:     claims.OrgRoles,
+		SID:          claims.SID,
+		Scope:        scope,
+		ClientID:     claims.ClientID,
+		Act:          claims.Act,
+		AuthTime:     claims.AuthTime,
+		TokenVersion: claims.TokenVersion,
+	})
+	if err != nil {
+		http.Error(w, "Error generating token", http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]interface{}{
+		"jwt_token":  token,
+		"token_type": "Bearer",
+		"expires_in": int(utils.AccessTokenTTL.Seconds()),
+		"scope":      scope,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, "Failed to write response", http.StatusInternalServerError)
+		log.Printf("Failed to encode response: %v\n", err)
+	}
+}
@@ -0,0 +1,66 @@
+package controller
+
+import (
+	"backend/utils"
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// SessionResponse is a session as shown to its owner
+type SessionResponse struct {
+	utils.Session
+	Current bool `json:"current"`
+}
+
+// ListSessionsHandler lists the devices the user is logged in on
+func ListSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value("claims").(*utils.Claims)
+
+	sessions, err := utils.ListSessions(claims.UID)
+	if err != nil {
+		http.Error(w, "Failed to retrieve sessions", http.StatusInternalServerError)
+		log.Printf("Failed to list sessions: %v\n", err)
+		return
+	}
+
+	response := make([]SessionResponse, 0, len(sessions))
+	for _, s := range sessions {
+		response = append(response, SessionResponse{Session: s, Current: s.ID == claims.SID})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, "Failed to write response", http.StatusInternalServerError)
+		log.Printf("Failed to encode response: %v\n", err)
+	}
+}
+
+// DeleteSessionHandler ends one of the user's sessions
+func DeleteSessionHandler(w http.ResponseWriter, r *http.Request) {
+	uid := r.Context().Value("uid").(string)
+	sessionID := mux.Vars(r)["id"]
+
+	session, err := utils.GetSession(uid, sessionID)
+	if err != nil {
+		http.Error(w, "Failed to retrieve session", http.StatusInternalServerError)
+		log.Printf("Failed to get session: %v\n", err)
+		return
+	}
+	if session == nil {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+
+	if err := utils.EndSession(uid, sessionID); err != nil {
+		http.Error(w, "Failed to end session", http.StatusInternalServerError)
+		log.Printf("Failed to end session: %v\n", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("Session ended successfully"))
+}
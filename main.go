@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"time"
 
 	"github.com/gorilla/mux"
 )
@@ -15,6 +16,12 @@ func main() {
 	// Initialize Firebase Auth and Database clients
 	utils.InitFirebase()
 
+	// Load the JWT signing keys (reads the environment loaded above)
+	utils.InitSigningKeys()
+
+	// Load the role registry, if it is configured
+	utils.InitRoles()
+
 	r := mux.NewRouter()
 
 	// Apply CORS middleware globally
@@ -23,14 +30,116 @@ func main() {
 	// Register routes that do not require authentication
 	r.HandleFunc("/register", controller.RegisterHandler).Methods("POST")
 	r.HandleFunc("/login", controller.LoginHandler).Methods("POST")
+	r.HandleFunc("/roles", controller.ListRolesHandler).Methods("GET")
+	r.HandleFunc("/token/refresh", controller.RefreshTokenHandler).Methods("POST")
 	r.HandleFunc("/forget-password", controller.ForgotPasswordHandler).Methods("POST")
 	r.HandleFunc("/resend-verification", controller.ResendVerificationHandler).Methods("POST")
+	r.HandleFunc("/invitations", controller.InvitationDetailsHandler).Methods("GET")
+	r.Handle("/invitations/accept", middleware.OptionalAuth(http.HandlerFunc(controller.AcceptInvitationHandler))).Methods("POST")
+	r.HandleFunc("/.well-known/jwks.json", controller.JWKSHandler).Methods("GET")
+	r.HandleFunc("/oauth/introspect", controller.IntrospectHandler).Methods("POST")
+
+	// OAuth 2.0 token endpoint, also used by service clients
+	r.HandleFunc("/oauth/token", controller.TokenHandler).Methods("POST")
 
-	// Apply AuthMiddleware to routes that require authentication
+	// OpenID Connect provider; relying parties must be able to verify our ID
+	// tokens, so it refuses to start with an HS256 key
+	if utils.OIDCProviderEnabled() {
+		if err := utils.CheckOIDCSigningKey(); err != nil {
+			log.Fatalf("Cannot enable the OpenID Connect provider: %v\n", err)
+		}
+		r.HandleFunc("/.well-known/openid-configuration", controller.OpenIDConfigurationHandler).Methods("GET")
+		r.HandleFunc("/oauth/authorize", controller.AuthorizeHandler).Methods("GET")
+		r.HandleFunc("/oauth/authorize", controller.AuthorizeSubmitHandler).Methods("POST")
+		r.Handle("/oauth/userinfo", middleware.AuthMiddleware(middleware.RequireUser(
+			middleware.RequireScope(utils.OIDCScopeOpenID)(http.HandlerFunc(controller.UserInfoHandler)),
+		))).Methods("GET", "POST")
+	}
+
+	// Apply AuthMiddleware to routes that require authentication. Who may
+	// call each route is set in the authorization policy file.
 	authenticatedRoutes := r.PathPrefix("/user").Subrouter()
 	authenticatedRoutes.Use(middleware.AuthMiddleware)
-	authenticatedRoutes.HandleFunc("/profile", controller.GetUserProfileHandler).Methods("GET")
-	authenticatedRoutes.HandleFunc("/enter_data", controller.EnterDataHandler).Methods("POST")
+	authenticatedRoutes.Use(middleware.RequireUser)
+	authenticatedRoutes.Use(middleware.EnforcePolicy)
+
+	// Each route also requires the scope that covers it. Minting tokens, which
+	// no scope covers, is kept from API keys and OAuth clients' tokens.
+	profileRead := middleware.RequireScope(utils.ScopeProfileRead)
+	profileWrite := middleware.RequireScope(utils.ScopeProfileWrite)
+	account := middleware.RequireScope(utils.ScopeAccount)
+
+	// Sensitive operations also need the password to have been entered recently
+	recentAuth := middleware.RequireRecentAuth(10 * time.Minute)
+
+	authenticatedRoutes.Handle("/profile", profileRead(http.HandlerFunc(controller.GetUserProfileHandler))).Methods("GET")
+	authenticatedRoutes.Handle("/enter_data", profileWrite(http.HandlerFunc(controller.EnterDataHandler))).Methods("POST")
+	authenticatedRoutes.Handle("/change-password", account(http.HandlerFunc(controller.ChangePasswordHandler))).Methods("POST")
+	authenticatedRoutes.HandleFunc("/logout", controller.LogoutHandler).Methods("POST")
+	authenticatedRoutes.Handle("/logout-all", account(http.HandlerFunc(controller.LogoutAllHandler))).Methods("POST")
+	authenticatedRoutes.Handle("/sessions", account(http.HandlerFunc(controller.ListSessionsHandler))).Methods("GET")
+	authenticatedRoutes.Handle("/sessions/{id}", account(http.HandlerFunc(controller.DeleteSessionHandler))).Methods("DELETE")
+	authenticatedRoutes.Handle("/api-keys", account(recentAuth(http.HandlerFunc(controller.CreateAPIKeyHandler)))).Methods("POST")
+	authenticatedRoutes.Handle("/api-keys", account(http.HandlerFunc(controller.ListAPIKeysHandler))).Methods("GET")
+	authenticatedRoutes.Handle("/api-keys/{id}", account(http.HandlerFunc(controller.RevokeAPIKeyHandler))).Methods("DELETE")
+	authenticatedRoutes.Handle("/tokens", middleware.RequireLoginToken(http.HandlerFunc(controller.ScopedTokenHandler))).Methods("POST")
+	authenticatedRoutes.Handle("/reauth", middleware.RequireLoginToken(http.HandlerFunc(controller.ReauthHandler))).Methods("POST")
+	authenticatedRoutes.Handle("/attendees/{uid}", profileRead(
+		middleware.RequireAttributes(utils.ActionViewAttendee, controller.AttendeeResource)(http.HandlerFunc(controller.AttendeeProfileHandler)),
+	)).Methods("GET")
+	authenticatedRoutes.Handle("/invitations", account(http.HandlerFunc(controller.CreateInvitationHandler))).Methods("POST")
+	authenticatedRoutes.Handle("/invitations", account(http.HandlerFunc(controller.ListInvitationsHandler))).Methods("GET")
+	authenticatedRoutes.Handle("/invitations/{id}", account(http.HandlerFunc(controller.RevokeInvitationHandler))).Methods("DELETE")
+	authenticatedRoutes.Handle("/orgs", account(http.HandlerFunc(controller.ListMyOrgsHandler))).Methods("GET")
+	authenticatedRoutes.Handle("/orgs/select", account(http.HandlerFunc(controller.SelectOrgHandler))).Methods("POST")
+	authenticatedRoutes.Handle("/orgs/{org}/members", account(http.HandlerFunc(controller.ListOrgMembersHandler))).Methods("GET")
+	authenticatedRoutes.Handle("/orgs/{org}/members/{uid}", account(http.HandlerFunc(controller.SetOrgMemberHandler))).Methods("PUT")
+	authenticatedRoutes.Handle("/orgs/{org}/members/{uid}", account(http.HandlerFunc(controller.RemoveOrgMemberHandler))).Methods("DELETE")
+
+	// Admin-only routes
+	adminRoutes := r.PathPrefix("/admin").Subrouter()
+	adminRoutes.Use(middleware.AuthMiddleware)
+	adminRoutes.Use(middleware.RequireUser)
+	adminRoutes.Use(middleware.RequireLoginToken)
+	adminRoutes.Use(middleware.RequireScope(utils.ScopeAdmin))
+	adminRoutes.Use(middleware.EnforcePolicy)
+	adminRoutes.Handle("/impersonate", recentAuth(http.HandlerFunc(controller.ImpersonateHandler))).Methods("POST")
+	adminRoutes.HandleFunc("/users", controller.ListUsersHandler).Methods("GET")
+	adminRoutes.HandleFunc("/users/{uid}", controller.GetUserHandler).Methods("GET")
+	adminRoutes.Handle("/users/{uid}", recentAuth(http.HandlerFunc(controller.DeleteUserHandler))).Methods("DELETE")
+	adminRoutes.Handle("/users/{uid}/roles", recentAuth(http.HandlerFunc(controller.SetUserRolesHandler))).Methods("PUT")
+	adminRoutes.HandleFunc("/users/{uid}/disable", controller.DisableUserHandler).Methods("POST")
+	adminRoutes.HandleFunc("/users/{uid}/enable", controller.EnableUserHandler).Methods("POST")
+	adminRoutes.HandleFunc("/users/{uid}/verify-email", controller.VerifyUserEmailHandler).Methods("POST")
+	adminRoutes.HandleFunc("/authorize/explain", controller.ExplainDecisionHandler).Methods("POST")
+	adminRoutes.HandleFunc("/organizer-requests", controller.ListOrganizerRequestsHandler).Methods("GET")
+	adminRoutes.HandleFunc("/organizer-requests/{uid}/approve", controller.ApproveOrganizerRequestHandler).Methods("POST")
+	adminRoutes.HandleFunc("/organizer-requests/{uid}/reject", controller.RejectOrganizerRequestHandler).Methods("POST")
+	adminRoutes.HandleFunc("/orgs", controller.CreateOrgHandler).Methods("POST")
+
+	// Routes for service clients using the client_credentials grant
+	serviceRoutes := r.PathPrefix("/service").Subrouter()
+	serviceRoutes.Use(middleware.AuthMiddleware)
+	serviceRoutes.Use(middleware.RequireService)
+	serviceRoutes.Use(middleware.EnforcePolicy)
+	serviceRoutes.Handle("/users/{uid}/profile", profileRead(http.HandlerFunc(controller.ServiceUserProfileHandler))).Methods("GET")
+
+	// Load the authorization policy for the guarded routes; it must have a
+	// rule for each of them and is reloaded when the file changes
+	utils.InitPolicy(middleware.PolicyCoverage(r, "/user", "/admin", "/service"))
+
+	// Periodically drop denylist entries of tokens that have expired anyway,
+	// and authorization codes that were never redeemed
+	go func() {
+		for range time.Tick(time.Hour) {
+			if err := utils.PruneRevokedTokens(); err != nil {
+				log.Printf("Failed to prune revoked tokens: %v\n", err)
+			}
+			if err := utils.PruneAuthorizationCodes(); err != nil {
+				log.Printf("Failed to prune authorization codes: %v\n", err)
+			}
+		}
+	}()
 
 	fmt.Println("Server started on port 8080")
 	log.Fatal(http.ListenAndServe(":8080", r))
@@ -0,0 +1,50 @@
+package middleware
+
+import (
+	"backend/utils"
+	"log"
+	"net/http"
+)
+
+// ResourceLoader returns the attributes of the resource a request is about,
+// or nil if it does not exist
+type ResourceLoader func(r *http.Request) (map[string]interface{}, error)
+
+// RequireAttributes returns a middleware that lets a request through only if
+// the attribute rules of the policy allow the action on the resource. It must
+// run after AuthMiddleware.
+func RequireAttributes(action string, resource ResourceLoader) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims := r.Context().Value("claims").(*utils.Claims)
+
+			principal, err := utils.PrincipalAttributes(claims)
+			if err != nil {
+				http.Error(w, "Failed to authorize request", http.StatusInternalServerError)
+				log.Printf("Failed to load principal attributes: %v\n", err)
+				return
+			}
+			attrs, err := resource(r)
+			if err != nil {
+				http.Error(w, "Failed to authorize request", http.StatusInternalServerError)
+				log.Printf("Failed to load resource attributes: %v\n", err)
+				return
+			}
+			if attrs == nil {
+				http.Error(w, "Not found", http.StatusNotFound)
+				return
+			}
+
+			decision := utils.Authorize(action, utils.Attributes{
+				utils.AttrPrincipal: principal,
+				utils.AttrResource:  attrs,
+				utils.AttrRequest:   utils.RequestAttributes(r),
+			})
+			if !decision.Allowed {
+				utils.Forbidden(w, "Access to this resource is "+decision.Reason)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -3,39 +3,142 @@ package middleware
 import (
 	"backend/utils"
 	"context"
+	"errors"
+	"log"
 	"net/http"
 	"strings"
+
+	"github.com/gorilla/mux"
 )
 
 // AuthMiddleware is the middleware to protect routes
 func AuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Extract token from Authorization header
-		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" {
-			http.Error(w, "Authorization header missing", http.StatusUnauthorized)
+		claims, ok := authenticate(w, r)
+		if !ok {
 			return
 		}
 
-		// Token should be in the format "Bearer <token>"
-		tokenParts := strings.Split(authHeader, " ")
-		if len(tokenParts) != 2 || tokenParts[0] != "Bearer" {
-			http.Error(w, "Invalid authorization token format", http.StatusUnauthorized)
-			return
+		// Every request made while impersonating a user is audited
+		if claims.Act != nil {
+			err := utils.RecordImpersonation(&utils.ImpersonationAudit{
+				Event:  utils.AuditImpersonationRequest,
+				Admin:  claims.Act.Sub,
+				Target: claims.UID,
+				JTI:    claims.Id,
+				Method: r.Method,
+				Path:   r.URL.Path,
+			})
+			if err != nil {
+				http.Error(w, "Failed to record audit trail", http.StatusInternalServerError)
+				log.Printf("Failed to record impersonated request: %v\n", err)
+				return
+			}
 		}
 
-		// Extract the token
-		tokenString := tokenParts[1]
-
-		// Verify the token using the utils.VerifyToken function
-		claims, err := utils.VerifyToken(tokenString)
-		if err != nil {
-			http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
+		// Routes about an organization ({org} in the path) only serve tokens
+		// issued for that organization. Routes about individual users check
+		// utils.TenantScope or the tenant attribute rules instead.
+		if org, ok := mux.Vars(r)["org"]; ok && org != claims.Org {
+			utils.Forbidden(w, "Token is not for this organization")
 			return
 		}
 
-		// Store the UID in context for use in the handler
+		// Store the UID, role, active org, the acting admin (if any) and the
+		// full claims in context for use in the handler
 		ctx := context.WithValue(r.Context(), "uid", claims.UID)
+		ctx = context.WithValue(ctx, "role", claims.Role)
+		ctx = context.WithValue(ctx, "org", claims.Org)
+		ctx = context.WithValue(ctx, "act", claims.Act)
+		ctx = context.WithValue(ctx, "claims", claims)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
+
+// OptionalAuth is for public routes that behave differently for a logged in
+// caller. Requests with credentials are authenticated like AuthMiddleware
+// does and have the claims in context; anonymous requests pass without them.
+func OptionalAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" && r.Header.Get("X-API-Key") == "" && !hasAccessTokenCookie(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		claims, ok := authenticate(w, r)
+		if !ok {
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), "claims", claims)))
+	})
+}
+
+// hasAccessTokenCookie reports whether a cookie session mode request carries
+// an access token
+func hasAccessTokenCookie(r *http.Request) bool {
+	if !utils.CookieModeEnabled() {
+		return false
+	}
+	cookie, err := r.Cookie(utils.AccessTokenCookie)
+	return err == nil && cookie.Value != ""
+}
+
+// authenticate resolves the caller from a "Bearer <token>" or "ApiKey <key>"
+// Authorization header, an X-API-Key header or, in cookie session mode, the
+// access_token cookie. It writes the error response and returns false if the
+// request must not proceed.
+func authenticate(w http.ResponseWriter, r *http.Request) (*utils.Claims, bool) {
+	// API keys may also be sent in their own header
+	credential := r.Header.Get("X-API-Key")
+	authHeader := r.Header.Get("Authorization")
+
+	// Browsers in cookie session mode send the token as a cookie instead.
+	// Cookies are attached to cross-site requests too, so state-changing
+	// requests must prove they can read the CSRF cookie.
+	if credential == "" && authHeader == "" && utils.CookieModeEnabled() {
+		if cookie, err := r.Cookie(utils.AccessTokenCookie); err == nil && cookie.Value != "" {
+			if utils.IsStateChanging(r) && !utils.ValidCSRF(r) {
+				utils.Forbidden(w, "Invalid or missing CSRF token")
+				return nil, false
+			}
+			credential = cookie.Value
+		}
+	}
+
+	if credential == "" {
+		// Extract token from Authorization header
+		if authHeader == "" {
+			http.Error(w, "Authorization header missing", http.StatusUnauthorized)
+			return nil, false
+		}
+
+		// Token should be in the format "Bearer <token>" or "ApiKey <key>"
+		tokenParts := strings.Split(authHeader, " ")
+		if len(tokenParts) != 2 || (tokenParts[0] != "Bearer" && tokenParts[0] != "ApiKey") {
+			http.Error(w, "Invalid authorization token format", http.StatusUnauthorized)
+			return nil, false
+		}
+
+		// Extract the token
+		credential = tokenParts[1]
+	}
+
+	// Verify the credential and check that it has not been revoked
+	claims, err := utils.Authenticate(credential)
+	switch {
+	case err == nil:
+		return claims, true
+	case errors.Is(err, utils.ErrTokenInvalid):
+		http.Error(w, "Invalid or expired token", http.StatusUnauthorized)
+	case errors.Is(err, utils.ErrAPIKeyInvalid):
+		http.Error(w, "Invalid or expired API key", http.StatusUnauthorized)
+	case errors.Is(err, utils.ErrTokenRevoked):
+		http.Error(w, "Token has been revoked", http.StatusUnauthorized)
+	case errors.Is(err, utils.ErrSessionEnded):
+		http.Error(w, "Session has ended", http.StatusUnauthorized)
+	default:
+		http.Error(w, "Failed to check token status", http.StatusInternalServerError)
+		log.Printf("Failed to authenticate request: %v\n", err)
+	}
+	return nil, false
+}
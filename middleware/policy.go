@@ -0,0 +1,91 @@
+package middleware
+
+import (
+	"backend/utils"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// EnforcePolicy checks the request against the rule of the authorization
+// policy for its route. Routes without a rule are denied. It must run after
+// AuthMiddleware; attach it to a subrouter with Use.
+func EnforcePolicy(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims := r.Context().Value("claims").(*utils.Claims)
+
+		route := mux.CurrentRoute(r)
+		if route == nil {
+			utils.Forbidden(w, "No policy rule for this route")
+			return
+		}
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			utils.Forbidden(w, "No policy rule for this route")
+			return
+		}
+
+		rule := utils.CurrentPolicy().Rule(r.Method, path)
+		if rule == nil {
+			utils.Forbidden(w, "No policy rule for this route")
+			return
+		}
+		if !rule.Allows(claims) {
+			utils.Forbidden(w, "Requires "+rule.Requirement())
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// PolicyCoverage returns a check for utils.InitPolicy that fails when a
+// route under one of the prefixes has no rule, or a rule matches no route
+func PolicyCoverage(router *mux.Router, prefixes ...string) func(*utils.Policy) error {
+	return func(p *utils.Policy) error {
+		routes := make(map[string]bool)
+		err := router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+			path, err := route.GetPathTemplate()
+			if err != nil {
+				return nil
+			}
+			methods, err := route.GetMethods()
+			if err != nil {
+				// Subrouter prefixes have no methods of their own
+				return nil
+			}
+			for _, method := range methods {
+				routes[method+" "+path] = true
+				routes["* "+path] = true
+				if !guarded(path, prefixes) {
+					continue
+				}
+				if p.Rule(method, path) == nil {
+					return fmt.Errorf("no policy rule for %s %s", method, path)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, rule := range p.Rules {
+			if !routes[rule.Method+" "+rule.Path] {
+				return fmt.Errorf("policy rule %s %s matches no route", rule.Method, rule.Path)
+			}
+		}
+		return nil
+	}
+}
+
+func guarded(path string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if path == prefix || strings.HasPrefix(path, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"backend/utils"
+	"net/http"
+)
+
+// RequireUser only lets through end users, keeping service principals away
+// from routes that act on the caller's own user record. It must run after
+// AuthMiddleware.
+func RequireUser(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims := r.Context().Value("claims").(*utils.Claims)
+		if claims.IsService() {
+			utils.Forbidden(w, "This route is only available to users")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireService only lets through service principals authenticated with the
+// client credentials grant. It must run after AuthMiddleware.
+func RequireService(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims := r.Context().Value("claims").(*utils.Claims)
+		if !claims.IsService() {
+			utils.Forbidden(w, "This route is only available to service clients")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireLoginToken keeps API keys and tokens issued to OAuth clients away
+// from routes that only the user themselves should reach, even if their scope
+// would otherwise allow it. It must run after AuthMiddleware.
+func RequireLoginToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		claims := r.Context().Value("claims").(*utils.Claims)
+		if claims.Source == utils.TokenSourceAPIKey || claims.ClientID != "" {
+			utils.Forbidden(w, "This route cannot be used with an API key or a client's token")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
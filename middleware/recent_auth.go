@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"backend/utils"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// RequireRecentAuth returns a middleware that rejects tokens whose user has
+// not entered their password within maxAge. Clients get a fresh token from
+// POST /user/reauth. It must run after AuthMiddleware.
+func RequireRecentAuth(maxAge time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims := r.Context().Value("claims").(*utils.Claims)
+
+			if claims.AuthTime == 0 || time.Since(time.Unix(claims.AuthTime, 0)) > maxAge {
+				// Step-up challenge as in RFC 9470
+				w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer error="insufficient_user_authentication", max_age=%d`, int(maxAge.Seconds())))
+				http.Error(w, "Recent authentication required, re-authenticate through /user/reauth", http.StatusUnauthorized)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"backend/utils"
+	"net/http"
+	"strings"
+)
+
+// RequireRole returns a middleware that only lets through users holding one
+// of the roles. It must run after AuthMiddleware and can be attached to a
+// subrouter with Use.
+func RequireRole(roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims := r.Context().Value("claims").(*utils.Claims)
+			if !claims.HasRole(roles...) {
+				utils.Forbidden(w, "Requires role "+strings.Join(roles, " or "))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequirePermission returns a middleware that only lets through users whose
+// role grants all of the permissions in the role registry. It must run
+// after AuthMiddleware and can be attached to a subrouter with Use.
+func RequirePermission(permissions ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims := r.Context().Value("claims").(*utils.Claims)
+			for _, permission := range permissions {
+				if !claims.HasPermission(permission) {
+					utils.Forbidden(w, "Requires permission "+permission)
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
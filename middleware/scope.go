@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"backend/utils"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// RequireScope returns a middleware that only lets through tokens granted all
+// of the given scopes. It must run after AuthMiddleware.
+func RequireScope(scopes ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims := r.Context().Value("claims").(*utils.Claims)
+
+			for _, scope := range scopes {
+				if !claims.HasScope(scope) {
+					w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer error="insufficient_scope", scope="%s"`, strings.Join(scopes, " ")))
+					utils.Forbidden(w, "Token lacks the required scope: "+scope)
+					return
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,432 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Effects of an attribute rule
+const (
+	EffectAllow = "allow"
+	EffectDeny  = "deny"
+)
+
+// Attribute namespaces a condition can refer to, e.g. "principal.city"
+const (
+	AttrPrincipal = "principal"
+	AttrResource  = "resource"
+	AttrRequest   = "request"
+)
+
+// Actions checked with attribute rules
+const (
+	ActionViewAttendee = "attendee:view"
+)
+
+// AttributeRule is an entry of the "attributes" section of the authorization
+// policy. It applies to a request for one of its actions when its condition
+// holds.
+type AttributeRule struct {
+	ID          string   `json:"id"`
+	Description string   `json:"description,omitempty"`
+	Actions     []string `json:"actions"`
+	// Effect is "allow" or "deny"; a matching deny rule always wins
+	Effect string `json:"effect"`
+	// When is the condition of the rule; a rule without one always applies
+	When *Condition `json:"when,omitempty"`
+}
+
+// Condition is a boolean expression over the attributes. Exactly one of All,
+// Any, Not or Attr is set. Attr compares the attribute with Value, or with
+// the attribute named by Ref.
+type Condition struct {
+	All []Condition `json:"all,omitempty"`
+	Any []Condition `json:"any,omitempty"`
+	Not *Condition  `json:"not,omitempty"`
+
+	Attr string `json:"attr,omitempty"`
+	// Op is one of eq, ne, in (Attr is one of the values), contains (Attr is a
+	// list holding the value), intersects (Attr and the value are lists with a
+	// common element) or exists
+	Op    string      `json:"op,omitempty"`
+	Value interface{} `json:"value,omitempty"`
+	Ref   string      `json:"ref,omitempty"`
+}
+
+// Attributes holds the principal, resource and request attributes a decision
+// is made on
+type Attributes map[string]map[string]interface{}
+
+// Decision is the outcome of Authorize, with the trace of every rule for the
+// action so it can be explained
+type Decision struct {
+	Action  string `json:"action"`
+	Allowed bool   `json:"allowed"`
+	// RuleID is the rule that decided, empty when no rule matched
+	RuleID string       `json:"rule_id,omitempty"`
+	Reason string       `json:"reason"`
+	Rules  []RuleResult `json:"rules"`
+}
+
+// RuleResult is how a single rule evaluated
+type RuleResult struct {
+	ID        string           `json:"id"`
+	Effect    string           `json:"effect"`
+	Matched   bool             `json:"matched"`
+	Condition *ConditionResult `json:"condition,omitempty"`
+}
+
+// ConditionResult is how a condition evaluated, with the values it compared
+type ConditionResult struct {
+	Expr     string            `json:"expr"`
+	Result   bool              `json:"result"`
+	Children []ConditionResult `json:"children,omitempty"`
+}
+
+// Authorize decides whether the action is allowed on the attributes using the
+// attribute rules of the current policy. A matching deny rule wins over any
+// allow rule, and the action is denied when no rule matches.
+func Authorize(action string, attrs Attributes) *Decision {
+	decision := &Decision{Action: action, Rules: []RuleResult{}}
+
+	var allow, deny *RuleResult
+	for _, rule := range CurrentPolicy().Attributes {
+		if !rule.appliesTo(action) {
+			continue
+		}
+		result := RuleResult{ID: rule.ID, Effect: rule.Effect, Matched: true}
+		if rule.When != nil {
+			condition := rule.When.evaluate(attrs)
+			result.Condition = &condition
+			result.Matched = condition.Result
+		}
+		decision.Rules = append(decision.Rules, result)
+	}
+	for i := range decision.Rules {
+		result := &decision.Rules[i]
+		if !result.Matched {
+			continue
+		}
+		if result.Effect == EffectDeny && deny == nil {
+			deny = result
+		}
+		if result.Effect == EffectAllow && allow == nil {
+			allow = result
+		}
+	}
+
+	switch {
+	case deny != nil:
+		decision.RuleID = deny.ID
+		decision.Reason = fmt.Sprintf("denied by rule %s", deny.ID)
+	case allow != nil:
+		decision.Allowed = true
+		decision.RuleID = allow.ID
+		decision.Reason = fmt.Sprintf("allowed by rule %s", allow.ID)
+	case len(decision.Rules) == 0:
+		decision.Reason = fmt.Sprintf("no rule covers %s", action)
+	default:
+		decision.Reason = fmt.Sprintf("no rule for %s matched", action)
+	}
+	return decision
+}
+
+func (rule *AttributeRule) appliesTo(action string) bool {
+	for _, a := range rule.Actions {
+		if a == action || a == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// evaluate evaluates the condition and records how it did
+func (c *Condition) evaluate(attrs Attributes) ConditionResult {
+	switch {
+	case len(c.All) > 0:
+		result := ConditionResult{Expr: "all", Result: true}
+		for i := range c.All {
+			child := c.All[i].evaluate(attrs)
+			result.Result = result.Result && child.Result
+			result.Children = append(result.Children, child)
+		}
+		return result
+	case len(c.Any) > 0:
+		result := ConditionResult{Expr: "any"}
+		for i := range c.Any {
+			child := c.Any[i].evaluate(attrs)
+			result.Result = result.Result || child.Result
+			result.Children = append(result.Children, child)
+		}
+		return result
+	case c.Not != nil:
+		child := c.Not.evaluate(attrs)
+		return ConditionResult{Expr: "not", Result: !child.Result, Children: []ConditionResult{child}}
+	}
+
+	left, ok := attrs.lookup(c.Attr)
+	if c.Op == "exists" {
+		return ConditionResult{Expr: fmt.Sprintf("%s exists", c.Attr), Result: ok}
+	}
+
+	right, rightOK := c.Value, true
+	operand := fmt.Sprintf("%#v", c.Value)
+	if c.Ref != "" {
+		right, rightOK = attrs.lookup(c.Ref)
+		operand = c.Ref
+	}
+	expr := fmt.Sprintf("%s %s %s (%s vs %s)", c.Attr, c.Op, operand, describe(left, ok), describe(right, rightOK))
+
+	// Missing attributes never compare equal, so two users without a city
+	// are not in the same city
+	if !ok || !rightOK {
+		return ConditionResult{Expr: expr, Result: c.Op == "ne"}
+	}
+
+	var result bool
+	switch c.Op {
+	case "eq":
+		result = equalValues(left, right)
+	case "ne":
+		result = !equalValues(left, right)
+	case "in":
+		result = listContains(right, left)
+	case "contains":
+		result = listContains(left, right)
+	case "intersects":
+		result = listsIntersect(left, right)
+	}
+	return ConditionResult{Expr: expr, Result: result}
+}
+
+// lookup returns the attribute named by a path like "principal.city"
+func (attrs Attributes) lookup(path string) (interface{}, bool) {
+	namespace, key, _ := strings.Cut(path, ".")
+	value, ok := attrs[namespace][key]
+	if !ok || value == nil || value == "" {
+		return nil, false
+	}
+	if v := reflect.ValueOf(value); v.Kind() == reflect.Slice && v.Len() == 0 {
+		return nil, false
+	}
+	return value, true
+}
+
+func describe(value interface{}, ok bool) string {
+	if !ok {
+		return "missing"
+	}
+	return fmt.Sprintf("%#v", value)
+}
+
+// normalize turns numbers into float64, as they come out of JSON, so that
+// attributes set in code compare equal to values from the policy file
+func normalize(value interface{}) interface{} {
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint())
+	case reflect.Float32:
+		return v.Float()
+	}
+	return value
+}
+
+func equalValues(a, b interface{}) bool {
+	return reflect.DeepEqual(normalize(a), normalize(b))
+}
+
+// listContains reports whether list is a slice holding value
+func listContains(list, value interface{}) bool {
+	v := reflect.ValueOf(list)
+	if v.Kind() != reflect.Slice {
+		return false
+	}
+	for i := 0; i < v.Len(); i++ {
+		if equalValues(v.Index(i).Interface(), value) {
+			return true
+		}
+	}
+	return false
+}
+
+// listsIntersect reports whether two slices hold a common value
+func listsIntersect(a, b interface{}) bool {
+	v := reflect.ValueOf(a)
+	if v.Kind() != reflect.Slice {
+		return false
+	}
+	for i := 0; i < v.Len(); i++ {
+		if listContains(b, v.Index(i).Interface()) {
+			return true
+		}
+	}
+	return false
+}
+
+// validate checks that the rule is well formed
+func (rule *AttributeRule) validate() error {
+	if rule.ID == "" {
+		return fmt.Errorf("attribute rule needs an id")
+	}
+	if len(rule.Actions) == 0 {
+		return fmt.Errorf("attribute rule %s names no actions", rule.ID)
+	}
+	if rule.Effect != EffectAllow && rule.Effect != EffectDeny {
+		return fmt.Errorf("attribute rule %s: effect must be allow or deny", rule.ID)
+	}
+	if rule.When != nil {
+		if err := rule.When.validate(); err != nil {
+			return fmt.Errorf("attribute rule %s: %v", rule.ID, err)
+		}
+	}
+	return nil
+}
+
+func (c *Condition) validate() error {
+	set := 0
+	for _, present := range []bool{len(c.All) > 0, len(c.Any) > 0, c.Not != nil, c.Attr != ""} {
+		if present {
+			set++
+		}
+	}
+	if set != 1 {
+		return fmt.Errorf("a condition needs exactly one of all, any, not or attr")
+	}
+
+	for _, children := range [][]Condition{c.All, c.Any} {
+		for i := range children {
+			if err := children[i].validate(); err != nil {
+				return err
+			}
+		}
+	}
+	if c.Not != nil {
+		return c.Not.validate()
+	}
+	if c.Attr == "" {
+		return nil
+	}
+
+	if err := validateAttrPath(c.Attr); err != nil {
+		return err
+	}
+	switch c.Op {
+	case "exists":
+		if c.Value != nil || c.Ref != "" {
+			return fmt.Errorf("%s: exists takes no value", c.Attr)
+		}
+		return nil
+	case "eq", "ne", "in", "contains", "intersects":
+	default:
+		return fmt.Errorf("%s: unknown op %q", c.Attr, c.Op)
+	}
+	if (c.Value == nil) == (c.Ref == "") {
+		return fmt.Errorf("%s: %s needs either a value or a ref", c.Attr, c.Op)
+	}
+	if c.Ref != "" {
+		return validateAttrPath(c.Ref)
+	}
+	if (c.Op == "in" || c.Op == "intersects") && reflect.ValueOf(c.Value).Kind() != reflect.Slice {
+		return fmt.Errorf("%s: %s needs a list value", c.Attr, c.Op)
+	}
+	return nil
+}
+
+func validateAttrPath(path string) error {
+	namespace, key, _ := strings.Cut(path, ".")
+	switch namespace {
+	case AttrPrincipal, AttrResource, AttrRequest:
+	default:
+		return fmt.Errorf("attribute %q must start with principal., resource. or request.", path)
+	}
+	if key == "" || strings.Contains(key, ".") {
+		return fmt.Errorf("attribute %q must name a single attribute", path)
+	}
+	return nil
+}
+
+// UserAttributes returns the attributes of a user as a principal or a
+// resource: uid, role, roles (including inherited ones), orgs, city and
+// gender. It returns nil if the user does not exist.
+func UserAttributes(uid string) (map[string]interface{}, error) {
+	roles, err := GetUserRoles(uid)
+	if err != nil {
+		return nil, err
+	}
+	if roles.Role == "" {
+		return nil, nil
+	}
+	attrs, err := profileAttributes(uid)
+	if err != nil {
+		return nil, err
+	}
+	attrs["uid"] = uid
+	attrs["role"] = roles.Role
+	attrs["roles"] = ExpandRoles(roles.List())
+	return attrs, nil
+}
+
+// profileAttributes reads the orgs, city and gender of users/{uid}, each on
+// its own so that the rest of the node (password hash, sessions, refresh
+// tokens) is never fetched
+func profileAttributes(uid string) (map[string]interface{}, error) {
+	orgs, err := ListUserOrgs(uid)
+	if err != nil {
+		return nil, err
+	}
+	attrs := map[string]interface{}{"orgs": orgs}
+	for _, field := range []string{"city", "gender"} {
+		var value string
+		if err := FirebaseDB.NewRef("users/"+uid+"/"+field).Get(context.Background(), &value); err != nil {
+			return nil, err
+		}
+		attrs[field] = value
+	}
+	return attrs, nil
+}
+
+// PrincipalAttributes returns the attributes of the caller. Users get their
+// profile attributes (see UserAttributes) with the roles taken from the
+// token rather than read again, plus the active org and their roles in it;
+// service clients only get uid, type and scopes.
+func PrincipalAttributes(claims *Claims) (map[string]interface{}, error) {
+	attrs := map[string]interface{}{}
+	if !claims.IsService() {
+		var err error
+		if attrs, err = profileAttributes(claims.UID); err != nil {
+			return nil, err
+		}
+	}
+
+	principalType := PrincipalUser
+	if claims.IsService() {
+		principalType = PrincipalService
+	}
+	attrs["uid"] = claims.UID
+	attrs["type"] = principalType
+	attrs["role"] = claims.Role
+	attrs["roles"] = ExpandRoles(claims.List())
+	attrs["scopes"] = strings.Fields(claims.Scope)
+	attrs["impersonated"] = claims.Act != nil
+	attrs["org"] = claims.Org
+	attrs["org_roles"] = ExpandRoles(claims.OrgRoles)
+	if claims.AuthTime != 0 {
+		attrs["auth_age"] = time.Now().Unix() - claims.AuthTime
+	}
+	return attrs, nil
+}
+
+// RequestAttributes returns the attributes of the request rules can refer to
+func RequestAttributes(r *http.Request) map[string]interface{} {
+	return map[string]interface{}{
+		"method": r.Method,
+		"path":   r.URL.Path,
+	}
+}
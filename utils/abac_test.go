@@ -0,0 +1,210 @@
+package utils
+
+import "testing"
+
+func TestConditionOperators(t *testing.T) {
+	attrs := Attributes{
+		AttrPrincipal: {
+			"uid":    "u1",
+			"city":   "Berlin",
+			"roles":  []string{"organizer", "user"},
+			"orgs":   []string{"o1", "o2"},
+			"age":    30,
+			"banned": false,
+		},
+		AttrResource: {
+			"uid":   "u2",
+			"city":  "Berlin",
+			"orgs":  []string{"o2"},
+			"empty": []string{},
+			"blank": "",
+		},
+	}
+
+	tests := []struct {
+		name string
+		cond Condition
+		want bool
+	}{
+		{"eq value", Condition{Attr: "principal.city", Op: "eq", Value: "Berlin"}, true},
+		{"eq other value", Condition{Attr: "principal.city", Op: "eq", Value: "Paris"}, false},
+		{"eq ref", Condition{Attr: "resource.city", Op: "eq", Ref: "principal.city"}, true},
+		{"eq number from JSON", Condition{Attr: "principal.age", Op: "eq", Value: float64(30)}, true},
+		{"eq false", Condition{Attr: "principal.banned", Op: "eq", Value: false}, true},
+		{"ne ref", Condition{Attr: "principal.uid", Op: "ne", Ref: "resource.uid"}, true},
+		{"ne same", Condition{Attr: "principal.city", Op: "ne", Ref: "resource.city"}, false},
+		{"in", Condition{Attr: "principal.city", Op: "in", Value: []interface{}{"Paris", "Berlin"}}, true},
+		{"not in", Condition{Attr: "principal.city", Op: "in", Value: []interface{}{"Paris"}}, false},
+		{"contains", Condition{Attr: "principal.roles", Op: "contains", Value: "organizer"}, true},
+		{"does not contain", Condition{Attr: "principal.roles", Op: "contains", Value: "admin"}, false},
+		{"contains on a string", Condition{Attr: "principal.city", Op: "contains", Value: "Berlin"}, false},
+		{"intersects", Condition{Attr: "principal.orgs", Op: "intersects", Ref: "resource.orgs"}, true},
+		{"no intersection", Condition{Attr: "principal.orgs", Op: "intersects", Value: []interface{}{"o3"}}, false},
+		{"exists", Condition{Attr: "principal.city", Op: "exists"}, true},
+		{"does not exist", Condition{Attr: "principal.gender", Op: "exists"}, false},
+		{"all", Condition{All: []Condition{
+			{Attr: "principal.city", Op: "eq", Value: "Berlin"},
+			{Attr: "principal.roles", Op: "contains", Value: "admin"},
+		}}, false},
+		{"any", Condition{Any: []Condition{
+			{Attr: "principal.city", Op: "eq", Value: "Paris"},
+			{Attr: "principal.roles", Op: "contains", Value: "organizer"},
+		}}, true},
+		{"not", Condition{Not: &Condition{Attr: "principal.city", Op: "exists"}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.cond.evaluate(attrs).Result; got != tt.want {
+				t.Errorf("evaluate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConditionMissingAttributes(t *testing.T) {
+	attrs := Attributes{
+		AttrPrincipal: {"city": "", "orgs": []string{}},
+		AttrResource:  {"city": nil},
+	}
+
+	tests := []struct {
+		name string
+		cond Condition
+		want bool
+	}{
+		{"empty string does not exist", Condition{Attr: "principal.city", Op: "exists"}, false},
+		{"empty list does not exist", Condition{Attr: "principal.orgs", Op: "exists"}, false},
+		{"nil does not exist", Condition{Attr: "resource.city", Op: "exists"}, false},
+		{"unknown namespace does not exist", Condition{Attr: "request.ip", Op: "exists"}, false},
+		{"two missing values are not equal", Condition{Attr: "principal.city", Op: "eq", Ref: "resource.city"}, false},
+		{"two missing values differ", Condition{Attr: "principal.city", Op: "ne", Ref: "resource.city"}, true},
+		{"missing value is in nothing", Condition{Attr: "principal.city", Op: "in", Value: []interface{}{""}}, false},
+		{"missing list contains nothing", Condition{Attr: "principal.orgs", Op: "contains", Value: "o1"}, false},
+		{"missing list intersects nothing", Condition{Attr: "principal.orgs", Op: "intersects", Value: []interface{}{"o1"}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.cond.evaluate(attrs).Result; got != tt.want {
+				t.Errorf("evaluate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	previous := CurrentPolicy()
+	t.Cleanup(func() { setPolicy(previous) })
+	setPolicy(&Policy{Attributes: []AttributeRule{
+		{ID: "self", Actions: []string{ActionViewAttendee}, Effect: EffectAllow,
+			When: &Condition{Attr: "principal.uid", Op: "eq", Ref: "resource.uid"}},
+		{ID: "admin-any", Actions: []string{"*"}, Effect: EffectAllow,
+			When: &Condition{Attr: "principal.roles", Op: "contains", Value: RoleAdmin}},
+		{ID: "no-banned", Actions: []string{ActionViewAttendee}, Effect: EffectDeny,
+			When: &Condition{Attr: "resource.banned", Op: "eq", Value: true}},
+	}})
+
+	tests := []struct {
+		name    string
+		action  string
+		attrs   Attributes
+		allowed bool
+		ruleID  string
+	}{
+		{
+			name:    "allow rule matches",
+			action:  ActionViewAttendee,
+			attrs:   Attributes{AttrPrincipal: {"uid": "u1"}, AttrResource: {"uid": "u1"}},
+			allowed: true,
+			ruleID:  "self",
+		},
+		{
+			name:   "deny wins over allow",
+			action: ActionViewAttendee,
+			attrs: Attributes{
+				AttrPrincipal: {"uid": "u1", "roles": []string{RoleAdmin}},
+				AttrResource:  {"uid": "u1", "banned": true},
+			},
+			allowed: false,
+			ruleID:  "no-banned",
+		},
+		{
+			name:    "no rule matches",
+			action:  ActionViewAttendee,
+			attrs:   Attributes{AttrPrincipal: {"uid": "u1"}, AttrResource: {"uid": "u2"}},
+			allowed: false,
+		},
+		{
+			name:    "wildcard action",
+			action:  "events:edit",
+			attrs:   Attributes{AttrPrincipal: {"roles": []string{RoleAdmin}}},
+			allowed: true,
+			ruleID:  "admin-any",
+		},
+		{
+			name:    "no rule covers the action",
+			action:  "events:edit",
+			attrs:   Attributes{AttrPrincipal: {"roles": []string{RoleUser}}},
+			allowed: false,
+		},
+		{
+			name:    "missing attributes do not match",
+			action:  ActionViewAttendee,
+			attrs:   Attributes{},
+			allowed: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decision := Authorize(tt.action, tt.attrs)
+			if decision.Allowed != tt.allowed || decision.RuleID != tt.ruleID {
+				t.Errorf("Authorize() = allowed %v by %q, want allowed %v by %q (%s)",
+					decision.Allowed, decision.RuleID, tt.allowed, tt.ruleID, decision.Reason)
+			}
+		})
+	}
+}
+
+func TestAttributeRuleValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    AttributeRule
+		wantErr bool
+	}{
+		{"valid", AttributeRule{ID: "r", Actions: []string{"a"}, Effect: EffectAllow,
+			When: &Condition{Attr: "principal.city", Op: "eq", Ref: "resource.city"}}, false},
+		{"no condition", AttributeRule{ID: "r", Actions: []string{"a"}, Effect: EffectDeny}, false},
+		{"missing id", AttributeRule{Actions: []string{"a"}, Effect: EffectAllow}, true},
+		{"no actions", AttributeRule{ID: "r", Effect: EffectAllow}, true},
+		{"unknown effect", AttributeRule{ID: "r", Actions: []string{"a"}, Effect: "maybe"}, true},
+		{"unknown op", AttributeRule{ID: "r", Actions: []string{"a"}, Effect: EffectAllow,
+			When: &Condition{Attr: "principal.city", Op: "like", Value: "B"}}, true},
+		{"unknown namespace", AttributeRule{ID: "r", Actions: []string{"a"}, Effect: EffectAllow,
+			When: &Condition{Attr: "user.city", Op: "exists"}}, true},
+		{"nested path", AttributeRule{ID: "r", Actions: []string{"a"}, Effect: EffectAllow,
+			When: &Condition{Attr: "principal.address.city", Op: "exists"}}, true},
+		{"value and ref", AttributeRule{ID: "r", Actions: []string{"a"}, Effect: EffectAllow,
+			When: &Condition{Attr: "principal.city", Op: "eq", Value: "B", Ref: "resource.city"}}, true},
+		{"neither value nor ref", AttributeRule{ID: "r", Actions: []string{"a"}, Effect: EffectAllow,
+			When: &Condition{Attr: "principal.city", Op: "eq"}}, true},
+		{"exists with a value", AttributeRule{ID: "r", Actions: []string{"a"}, Effect: EffectAllow,
+			When: &Condition{Attr: "principal.city", Op: "exists", Value: "B"}}, true},
+		{"in without a list", AttributeRule{ID: "r", Actions: []string{"a"}, Effect: EffectAllow,
+			When: &Condition{Attr: "principal.city", Op: "in", Value: "B"}}, true},
+		{"two kinds of condition", AttributeRule{ID: "r", Actions: []string{"a"}, Effect: EffectAllow,
+			When: &Condition{Attr: "principal.city", Op: "exists", Not: &Condition{Attr: "principal.uid", Op: "exists"}}}, true},
+		{"invalid child", AttributeRule{ID: "r", Actions: []string{"a"}, Effect: EffectAllow,
+			When: &Condition{All: []Condition{{Attr: "principal.city", Op: "exists"}, {Op: "eq"}}}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.rule.validate()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"firebase.google.com/go/auth"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// CheckPassword compares the password with the hash stored for the user
+func CheckPassword(uid, password string) error {
+	var hashedPassword string
+	if err := FirebaseDB.NewRef("users/"+uid+"/hashed_password").Get(context.Background(), &hashedPassword); err != nil {
+		return err
+	}
+	if hashedPassword == "" || bcrypt.CompareHashAndPassword([]byte(hashedPassword), []byte(password)) != nil {
+		return ErrInvalidCredentials
+	}
+	return nil
+}
+
+// SetUserRoles replaces the user's roles; the first one becomes the primary
+// role. Single-role records are migrated to the roles list on their first
+// change. The roles are mirrored into the user's Firebase custom claims, and
+// the user's token version is bumped so tokens with the old roles stop working.
+func SetUserRoles(uid string, roles []string) error {
+	if len(roles) == 0 {
+		return errors.New("a user needs at least one role")
+	}
+	if err := StoreUserRoles(uid, NewUserRoles(roles...)); err != nil {
+		return err
+	}
+	return BumpTokenVersion(uid)
+}
+
+// StoreUserRoles writes the roles to users/{uid} and the user's Firebase
+// custom claims. Use SetUserRoles to change the roles of an existing user.
+func StoreUserRoles(uid string, roles UserRoles) error {
+	err := FirebaseDB.NewRef("users/"+uid).Update(context.Background(), map[string]interface{}{
+		"role":  roles.Role,
+		"roles": roles.List(),
+	})
+	if err != nil {
+		return err
+	}
+	return SyncRoleClaims(uid, roles)
+}
+
+// SetUserPassword stores a new password hash for the user and ends all of the
+// user's sessions
+func SetUserPassword(uid, password string) error {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	if err := FirebaseDB.NewRef("users/"+uid+"/hashed_password").Set(context.Background(), string(hashedPassword)); err != nil {
+		return err
+	}
+	return RevokeAllTokens(uid)
+}
+
+// SetUserDisabled disables or re-enables the user's Firebase account. Disabling
+// also ends all of the user's sessions and revokes the user's API keys.
+func SetUserDisabled(uid string, disabled bool) error {
+	params := (&auth.UserToUpdate{}).Disabled(disabled)
+	if _, err := FirebaseAuth.UpdateUser(context.Background(), uid, params); err != nil {
+		return err
+	}
+	if disabled {
+		if err := RevokeAllAPIKeys(uid); err != nil {
+			return err
+		}
+		return RevokeAllTokens(uid)
+	}
+	return BumpTokenVersion(uid)
+}
+
+// SetEmailVerified marks the user's email address as verified
+func SetEmailVerified(uid string) error {
+	params := (&auth.UserToUpdate{}).EmailVerified(true)
+	_, err := FirebaseAuth.UpdateUser(context.Background(), uid, params)
+	return err
+}
+
+// DeleteUser removes the user from Firebase Auth, the database and any
+// organizations. The users/{uid} node is replaced by a tombstone holding the
+// bumped token version, so access tokens issued before the deletion stop
+// working. It is safe to call again if a previous attempt failed halfway.
+// It returns ErrLastOrgAdmin, before changing anything, if the user is the
+// only admin of an organization.
+func DeleteUser(uid string) error {
+	orgs, err := ListUserOrgs(uid)
+	if err != nil {
+		return err
+	}
+	for _, org := range orgs {
+		member, err := GetOrgMember(org, uid)
+		if err != nil {
+			return err
+		}
+		if member != nil && NewUserRoles(member.Roles...).HasRole(RoleAdmin) {
+			if err := CheckOrgKeepsAdmin(org, uid, nil); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := RevokeAllAPIKeys(uid); err != nil {
+		return err
+	}
+	for _, org := range orgs {
+		if err := RemoveOrgMember(org, uid); err != nil {
+			return err
+		}
+	}
+	if err := BumpTokenVersion(uid); err != nil {
+		return err
+	}
+	version, err := GetTokenVersion(uid)
+	if err != nil {
+		return err
+	}
+	err = FirebaseDB.NewRef("users/"+uid).Set(context.Background(), map[string]interface{}{
+		"token_version": version,
+		"deleted_at":    time.Now().Unix(),
+	})
+	if err != nil {
+		return err
+	}
+	if err := FirebaseAuth.DeleteUser(context.Background(), uid); err != nil && !auth.IsUserNotFound(err) {
+		return err
+	}
+	return nil
+}
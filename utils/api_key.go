@@ -0,0 +1,202 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// TokenSourceAPIKey marks claims that were built from an API key
+const TokenSourceAPIKey = "api_key"
+
+// apiKeyPrefix makes our keys easy to recognise, e.g. by secret scanners
+const apiKeyPrefix = "zk_"
+
+var ErrAPIKeyInvalid = errors.New("invalid or expired API key")
+
+// APIKey is stored under users/{uid}/api_keys/{id}. The key itself is only
+// shown once at creation; api_keys/{hash} maps its hash back to the owner.
+type APIKey struct {
+	ID         string   `json:"id"`
+	Name       string   `json:"name"`
+	Scopes     []string `json:"scopes"`
+	Hash       string   `json:"hash,omitempty"`
+	CreatedAt  int64    `json:"created_at"`
+	ExpiresAt  int64    `json:"expires_at,omitempty"`
+	LastUsedAt int64    `json:"last_used_at,omitempty"`
+}
+
+// apiKeyIndex is the record stored under api_keys/{hash}
+type apiKeyIndex struct {
+	UID   string `json:"uid"`
+	KeyID string `json:"key_id"`
+}
+
+var (
+	apiKeyUsageMu sync.Mutex
+	apiKeyUsage   = make(map[string]int64)
+)
+
+func apiKeyPath(uid, id string) string {
+	return "users/" + uid + "/api_keys/" + id
+}
+
+// CreateAPIKey generates a new API key for the user. A zero expiresAt creates
+// a key that does not expire.
+func CreateAPIKey(uid, name string, scopes []string, expiresAt time.Time) (string, *APIKey, error) {
+	id, err := randomToken(9)
+	if err != nil {
+		return "", nil, err
+	}
+	secret, err := randomToken(32)
+	if err != nil {
+		return "", nil, err
+	}
+	key := apiKeyPrefix + secret
+
+	record := &APIKey{
+		ID:        id,
+		Name:      name,
+		Scopes:    scopes,
+		Hash:      hashToken(key),
+		CreatedAt: time.Now().Unix(),
+	}
+	if !expiresAt.IsZero() {
+		record.ExpiresAt = expiresAt.Unix()
+	}
+
+	err = FirebaseDB.NewRef("").Update(context.Background(), map[string]interface{}{
+		apiKeyPath(uid, id):       record,
+		"api_keys/" + record.Hash: apiKeyIndex{UID: uid, KeyID: id},
+	})
+	if err != nil {
+		return "", nil, err
+	}
+	return key, record, nil
+}
+
+// ListAPIKeys returns the user's API keys, newest first
+func ListAPIKeys(uid string) ([]APIKey, error) {
+	var keys map[string]APIKey
+	if err := FirebaseDB.NewRef("users/"+uid+"/api_keys").Get(context.Background(), &keys); err != nil {
+		return nil, err
+	}
+
+	list := make([]APIKey, 0, len(keys))
+	for _, k := range keys {
+		list = append(list, k)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt > list[j].CreatedAt })
+	return list, nil
+}
+
+// GetAPIKey returns one of the user's API keys, or nil if it does not exist
+func GetAPIKey(uid, id string) (*APIKey, error) {
+	var key APIKey
+	if err := FirebaseDB.NewRef(apiKeyPath(uid, id)).Get(context.Background(), &key); err != nil {
+		return nil, err
+	}
+	if key.ID == "" {
+		return nil, nil
+	}
+	return &key, nil
+}
+
+// RevokeAPIKey deletes the API key and its hash index
+func RevokeAPIKey(uid string, key *APIKey) error {
+	return FirebaseDB.NewRef("").Update(context.Background(), map[string]interface{}{
+		apiKeyPath(uid, key.ID): nil,
+		"api_keys/" + key.Hash:  nil,
+	})
+}
+
+// RevokeAllAPIKeys deletes every API key of the user
+func RevokeAllAPIKeys(uid string) error {
+	keys, err := ListAPIKeys(uid)
+	if err != nil {
+		return err
+	}
+	for i := range keys {
+		if err := RevokeAPIKey(uid, &keys[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// VerifyAPIKey looks up the API key and returns claims for its owner. The
+// key's last_used_at is updated at most once a minute.
+func VerifyAPIKey(key string) (*Claims, error) {
+	return verifyAPIKey(key, true)
+}
+
+// verifyAPIKey is VerifyAPIKey; recordUse controls whether last_used_at is
+// updated
+func verifyAPIKey(key string, recordUse bool) (*Claims, error) {
+	hash := hashToken(key)
+
+	var index apiKeyIndex
+	if err := FirebaseDB.NewRef("api_keys/"+hash).Get(context.Background(), &index); err != nil {
+		return nil, err
+	}
+	if index.UID == "" {
+		return nil, ErrAPIKeyInvalid
+	}
+
+	record, err := GetAPIKey(index.UID, index.KeyID)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if record == nil || record.Hash != hash || (record.ExpiresAt != 0 && now.Unix() >= record.ExpiresAt) {
+		return nil, ErrAPIKeyInvalid
+	}
+
+	roles, err := GetUserRoles(index.UID)
+	if err != nil {
+		return nil, err
+	}
+
+	if recordUse {
+		recordAPIKeyUse(index.UID, record, now)
+	}
+
+	return &Claims{
+		UID:       index.UID,
+		UserRoles: roles,
+		Scope:     strings.Join(record.Scopes, " "),
+		Source:    TokenSourceAPIKey,
+		StandardClaims: jwt.StandardClaims{
+			Id:        record.ID,
+			Subject:   index.UID,
+			IssuedAt:  record.CreatedAt,
+			ExpiresAt: record.ExpiresAt,
+		},
+	}, nil
+}
+
+func recordAPIKeyUse(uid string, record *APIKey, now time.Time) {
+	apiKeyUsageMu.Lock()
+	lastUsed := apiKeyUsage[record.ID]
+	if lastUsed < record.LastUsedAt {
+		lastUsed = record.LastUsedAt
+	}
+	if now.Unix()-lastUsed < int64(lastSeenInterval.Seconds()) {
+		apiKeyUsageMu.Unlock()
+		return
+	}
+	apiKeyUsage[record.ID] = now.Unix()
+	apiKeyUsageMu.Unlock()
+
+	if err := FirebaseDB.NewRef(apiKeyPath(uid, record.ID)).Update(context.Background(), map[string]interface{}{
+		"last_used_at": now.Unix(),
+	}); err != nil {
+		log.Printf("Failed to update API key last_used_at: %v", err)
+	}
+}
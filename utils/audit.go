@@ -0,0 +1,31 @@
+package utils
+
+import (
+	"context"
+	"time"
+)
+
+// Impersonation audit events
+const (
+	AuditImpersonationIssued  = "issued"
+	AuditImpersonationRequest = "request"
+)
+
+// ImpersonationAudit is an entry of the audit/impersonation trail
+type ImpersonationAudit struct {
+	Event  string `json:"event"`
+	Admin  string `json:"admin"`
+	Target string `json:"target"`
+	JTI    string `json:"jti"`
+	Reason string `json:"reason,omitempty"`
+	Method string `json:"method,omitempty"`
+	Path   string `json:"path,omitempty"`
+	At     int64  `json:"at"`
+}
+
+// RecordImpersonation appends an entry to the impersonation audit trail
+func RecordImpersonation(entry *ImpersonationAudit) error {
+	entry.At = time.Now().Unix()
+	_, err := FirebaseDB.NewRef("audit/impersonation").Push(context.Background(), entry)
+	return err
+}
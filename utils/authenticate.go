@@ -0,0 +1,54 @@
+package utils
+
+import (
+	"errors"
+	"strings"
+)
+
+var ErrTokenInvalid = errors.New("invalid or expired token")
+
+// Authenticate resolves a bearer credential to the claims of its principal.
+// API keys are recognised by their prefix; everything else must be one of our
+// access tokens or, when enabled, a Firebase ID token. Besides ErrTokenInvalid
+// it returns ErrAPIKeyInvalid, ErrTokenRevoked and ErrSessionEnded for
+// credentials that must be rejected; any other error is internal.
+func Authenticate(credential string) (*Claims, error) {
+	return authenticate(credential, true)
+}
+
+// Inspect runs the checks of Authenticate without counting as a use of the
+// credential: the session's last_seen and the API key's last_used_at are left
+// alone. Token introspection uses it, so a resource server checking a token
+// does not show up as activity of its owner.
+func Inspect(credential string) (*Claims, error) {
+	return authenticate(credential, false)
+}
+
+func authenticate(credential string, recordUse bool) (*Claims, error) {
+	if strings.HasPrefix(credential, apiKeyPrefix) {
+		return verifyAPIKey(credential, recordUse)
+	}
+
+	claims, err := VerifyToken(credential)
+	if err != nil && FirebaseIDTokensEnabled() {
+		claims, err = VerifyFirebaseIDToken(credential)
+	}
+	if err != nil {
+		return nil, ErrTokenInvalid
+	}
+
+	// Firebase checks revocation of its own tokens while verifying them
+	if claims.Source == TokenSourceFirebase {
+		return claims, nil
+	}
+
+	if err := CheckTokenRevoked(claims); err != nil {
+		return nil, err
+	}
+	if claims.SID != "" {
+		if err := checkSession(claims.UID, claims.SID, recordUse); err != nil {
+			return nil, err
+		}
+	}
+	return claims, nil
+}
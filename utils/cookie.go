@@ -0,0 +1,96 @@
+package utils
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"os"
+	"time"
+)
+
+// Cookie names used in cookie session mode
+const (
+	AccessTokenCookie  = "access_token"
+	RefreshTokenCookie = "refresh_token"
+	CSRFTokenCookie    = "csrf_token"
+	// CSRFHeader must echo the csrf_token cookie on state-changing requests
+	CSRFHeader = "X-CSRF-Token"
+)
+
+// refreshCookiePath limits the refresh token cookie to the refresh endpoint
+const refreshCookiePath = "/token/refresh"
+
+// CookieModeEnabled reports whether clients may ask LoginHandler for cookies
+// instead of tokens in the response body (AUTH_COOKIE_MODE=true)
+func CookieModeEnabled() bool {
+	return os.Getenv("AUTH_COOKIE_MODE") == "true"
+}
+
+// WantsCookies reports whether the client opted into cookie session mode with
+// the "X-Auth-Mode: cookie" header
+func WantsCookies(r *http.Request) bool {
+	return CookieModeEnabled() && r.Header.Get("X-Auth-Mode") == "cookie"
+}
+
+// cookieSameSite is Strict unless COOKIE_SAMESITE=lax, which is needed when
+// the frontend is served from another site
+func cookieSameSite() http.SameSite {
+	if os.Getenv("COOKIE_SAMESITE") == "lax" {
+		return http.SameSiteLaxMode
+	}
+	return http.SameSiteStrictMode
+}
+
+func newCookie(name, value, path string, maxAge time.Duration, httpOnly bool) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		MaxAge:   int(maxAge.Seconds()),
+		Secure:   true,
+		HttpOnly: httpOnly,
+		SameSite: cookieSameSite(),
+	}
+}
+
+// SetSessionCookies stores the token pair in HttpOnly cookies and sets a new
+// CSRF token cookie, which is returned so it can also go in the response body
+func SetSessionCookies(w http.ResponseWriter, accessToken, refreshToken string) (string, error) {
+	csrfToken, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	http.SetCookie(w, newCookie(AccessTokenCookie, accessToken, "/", AccessTokenTTL, true))
+	http.SetCookie(w, newCookie(RefreshTokenCookie, refreshToken, refreshCookiePath, RefreshTokenTTL, true))
+	// Readable by the frontend, which sends it back in the X-CSRF-Token header
+	http.SetCookie(w, newCookie(CSRFTokenCookie, csrfToken, "/", RefreshTokenTTL, false))
+	return csrfToken, nil
+}
+
+// ClearSessionCookies removes the cookies set by SetSessionCookies
+func ClearSessionCookies(w http.ResponseWriter) {
+	http.SetCookie(w, newCookie(AccessTokenCookie, "", "/", -time.Second, true))
+	http.SetCookie(w, newCookie(RefreshTokenCookie, "", refreshCookiePath, -time.Second, true))
+	http.SetCookie(w, newCookie(CSRFTokenCookie, "", "/", -time.Second, false))
+}
+
+// IsStateChanging reports whether the request method can change state and
+// therefore needs CSRF protection
+func IsStateChanging(r *http.Request) bool {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+	return true
+}
+
+// ValidCSRF implements the double-submit check: the X-CSRF-Token header must
+// match the csrf_token cookie
+func ValidCSRF(r *http.Request) bool {
+	cookie, err := r.Cookie(CSRFTokenCookie)
+	if err != nil || cookie.Value == "" {
+		return false
+	}
+	header := r.Header.Get(CSRFHeader)
+	return subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(header)) == 1
+}
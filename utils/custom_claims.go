@@ -0,0 +1,51 @@
+package utils
+
+import (
+	"context"
+	"reflect"
+)
+
+// Keys of the Firebase custom claims that mirror the roles in users/{uid}
+const (
+	customClaimRole  = "role"
+	customClaimRoles = "roles"
+)
+
+// roleClaims returns the user's custom claims with the role claims set to the
+// roles, keeping any other claims
+func roleClaims(current map[string]interface{}, roles UserRoles) map[string]interface{} {
+	claims := make(map[string]interface{}, len(current)+2)
+	for k, v := range current {
+		claims[k] = v
+	}
+	claims[customClaimRole] = roles.Role
+	claims[customClaimRoles] = roles.List()
+	return claims
+}
+
+// RoleClaimsInSync reports whether the custom claims already mirror the roles
+func RoleClaimsInSync(current map[string]interface{}, roles UserRoles) bool {
+	role, _ := current[customClaimRole].(string)
+	var list []string
+	if values, ok := current[customClaimRoles].([]interface{}); ok {
+		for _, v := range values {
+			s, _ := v.(string)
+			list = append(list, s)
+		}
+	}
+	return role == roles.Role && reflect.DeepEqual(list, roles.List())
+}
+
+// SyncRoleClaims mirrors the roles into the user's Firebase custom claims, so
+// client SDKs and security rules can read them from the ID token. The claims
+// reach clients the next time their ID token is refreshed.
+func SyncRoleClaims(uid string, roles UserRoles) error {
+	user, err := FirebaseAuth.GetUser(context.Background(), uid)
+	if err != nil {
+		return err
+	}
+	if RoleClaimsInSync(user.CustomClaims, roles) {
+		return nil
+	}
+	return FirebaseAuth.SetCustomUserClaims(context.Background(), uid, roleClaims(user.CustomClaims, roles))
+}
@@ -0,0 +1,55 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// TokenSourceFirebase marks claims taken from a Firebase ID token rather than
+// from a token issued by GenerateJWT
+const TokenSourceFirebase = "firebase"
+
+// FirebaseIDTokensEnabled reports whether AuthMiddleware should fall back to
+// Firebase ID tokens (AUTH_ACCEPT_FIREBASE_ID_TOKENS=true)
+func FirebaseIDTokensEnabled() bool {
+	return os.Getenv("AUTH_ACCEPT_FIREBASE_ID_TOKENS") == "true"
+}
+
+// VerifyFirebaseIDToken verifies an ID token issued by the Firebase client SDK
+// and maps it onto our Claims, taking the roles from users/{uid}
+func VerifyFirebaseIDToken(idToken string) (*Claims, error) {
+	// Also rejects tokens whose Firebase sessions were revoked
+	token, err := FirebaseAuth.VerifyIDTokenAndCheckRevoked(context.Background(), idToken)
+	if err != nil {
+		return nil, err
+	}
+	// Our own login refuses unverified addresses, and so do we here
+	if verified, _ := token.Claims["email_verified"].(bool); !verified {
+		return nil, fmt.Errorf("user %s has not verified their email", token.UID)
+	}
+
+	roles, err := GetUserRoles(token.UID)
+	if err != nil {
+		return nil, err
+	}
+	if roles.Role == "" {
+		return nil, fmt.Errorf("user %s has no role", token.UID)
+	}
+
+	return &Claims{
+		UID:       token.UID,
+		UserRoles: roles,
+		Scope:     DefaultScope(),
+		AuthTime:  token.AuthTime,
+		Source:    TokenSourceFirebase,
+		StandardClaims: jwt.StandardClaims{
+			Subject:   token.UID,
+			Issuer:    token.Issuer,
+			IssuedAt:  token.IssuedAt,
+			ExpiresAt: token.Expires,
+		},
+	}, nil
+}
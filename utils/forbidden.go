@@ -0,0 +1,23 @@
+package utils
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// Forbidden writes the 403 response used by every authorization check, so
+// clients can rely on a single format:
+//
+//	{"error": "forbidden", "message": "..."}
+func Forbidden(w http.ResponseWriter, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusForbidden)
+	if err := json.NewEncoder(w).Encode(map[string]string{
+		"error":   "forbidden",
+		"message": message,
+	}); err != nil {
+		log.Printf("Failed to encode response: %v\n", err)
+	}
+}
@@ -0,0 +1,245 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"os"
+	"sort"
+	"time"
+
+	"firebase.google.com/go/db"
+	"github.com/dgrijalva/jwt-go"
+)
+
+// InvitationTTL is how long an invitation link can be used
+const InvitationTTL = 7 * 24 * time.Hour
+
+// Invitation statuses; pending invitations past their expiry are listed as
+// expired
+const (
+	InvitationPending  = "pending"
+	InvitationAccepted = "accepted"
+	InvitationRevoked  = "revoked"
+	InvitationExpired  = "expired"
+)
+
+// invitationAudience keeps invitation links from being accepted as any other
+// token we sign, and the other way round
+const invitationAudience = "invitation"
+
+var (
+	ErrInvitationInvalid   = errors.New("invalid, expired or already used invitation")
+	ErrInvitationURLNotSet = errors.New("set INVITATION_URL, or JWT_ISSUER to the public URL of this server")
+)
+
+// Invitation is stored under invitations/{id}. The link sent to the invitee
+// carries a signed token naming the invitation; accepting it registers the
+// invitee, or adds the roles to their existing account.
+type Invitation struct {
+	ID         string   `json:"id"`
+	Email      string   `json:"email"`
+	Roles      []string `json:"roles"`
+	InvitedBy  string   `json:"invited_by"`
+	Status     string   `json:"status"`
+	CreatedAt  int64    `json:"created_at"`
+	ExpiresAt  int64    `json:"expires_at"`
+	AcceptedBy string   `json:"accepted_by,omitempty"`
+	ClosedAt   int64    `json:"closed_at,omitempty"` // when it was accepted or revoked
+}
+
+// invitationClaims is the payload of an invitation token
+type invitationClaims struct {
+	Invitation string `json:"inv"`
+	Email      string `json:"email"`
+	jwt.StandardClaims
+}
+
+// CreateInvitation stores an invitation and returns it with the signed token
+// for its link
+func CreateInvitation(inviter, email string, roles []string) (*Invitation, string, error) {
+	id, err := randomToken(9)
+	if err != nil {
+		return nil, "", err
+	}
+
+	now := time.Now()
+	invitation := &Invitation{
+		ID:        id,
+		Email:     email,
+		Roles:     roles,
+		InvitedBy: inviter,
+		Status:    InvitationPending,
+		CreatedAt: now.Unix(),
+		ExpiresAt: now.Add(InvitationTTL).Unix(),
+	}
+	token, err := signToken(&invitationClaims{
+		Invitation: id,
+		Email:      email,
+		StandardClaims: jwt.StandardClaims{
+			Issuer:    Issuer(),
+			Audience:  invitationAudience,
+			IssuedAt:  invitation.CreatedAt,
+			ExpiresAt: invitation.ExpiresAt,
+		},
+	})
+	if err != nil {
+		return nil, "", err
+	}
+
+	if err := FirebaseDB.NewRef("invitations/"+id).Set(context.Background(), invitation); err != nil {
+		return nil, "", err
+	}
+	return invitation, token, nil
+}
+
+// InvitationURL is the page the invitation link points to: INVITATION_URL (the
+// page of the frontend that accepts invitations), or else the GET
+// /invitations route on JWT_ISSUER. It fails if neither is an absolute URL.
+func InvitationURL() (string, error) {
+	base := os.Getenv("INVITATION_URL")
+	if base == "" {
+		base = Issuer() + "/invitations"
+	}
+	if u, err := url.Parse(base); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", ErrInvitationURLNotSet
+	}
+	return base, nil
+}
+
+// InvitationLink is the URL sent to the invitee: the invitation URL with the
+// token as a query parameter
+func InvitationLink(base, token string) string {
+	return base + "?token=" + url.QueryEscape(token)
+}
+
+// GetInvitation returns the invitation, or nil if it does not exist
+func GetInvitation(id string) (*Invitation, error) {
+	var invitation Invitation
+	if err := FirebaseDB.NewRef("invitations/"+id).Get(context.Background(), &invitation); err != nil {
+		return nil, err
+	}
+	if invitation.ID == "" {
+		return nil, nil
+	}
+	return &invitation, nil
+}
+
+// VerifyInvitation checks the token's signature and returns the pending
+// invitation it names, or ErrInvitationInvalid
+func VerifyInvitation(token string) (*Invitation, error) {
+	var claims invitationClaims
+	if _, err := jwt.ParseWithClaims(token, &claims, tokenKey); err != nil {
+		return nil, ErrInvitationInvalid
+	}
+	if claims.Audience != invitationAudience || claims.Invitation == "" {
+		return nil, ErrInvitationInvalid
+	}
+
+	invitation, err := GetInvitation(claims.Invitation)
+	if err != nil {
+		return nil, err
+	}
+	if invitation == nil || invitation.Email != claims.Email || invitation.Status != InvitationPending ||
+		time.Now().Unix() >= invitation.ExpiresAt {
+		return nil, ErrInvitationInvalid
+	}
+	return invitation, nil
+}
+
+// ListInvitations returns the invitations sent by the user, newest first. It
+// relies on an ".indexOn": "invited_by" rule for invitations.
+func ListInvitations(inviter string) ([]Invitation, error) {
+	var invitations map[string]Invitation
+	err := FirebaseDB.NewRef("invitations").OrderByChild("invited_by").EqualTo(inviter).Get(context.Background(), &invitations)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().Unix()
+	list := make([]Invitation, 0, len(invitations))
+	for _, invitation := range invitations {
+		if invitation.Status == InvitationPending && now >= invitation.ExpiresAt {
+			invitation.Status = InvitationExpired
+		}
+		list = append(list, invitation)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt > list[j].CreatedAt })
+	return list, nil
+}
+
+// closeInvitation moves a pending invitation to status, so that a link can
+// only be used once and revoked links stop working
+func closeInvitation(id, status string) error {
+	return FirebaseDB.NewRef("invitations/"+id).Transaction(context.Background(), func(node db.TransactionNode) (interface{}, error) {
+		var invitation Invitation
+		if err := node.Unmarshal(&invitation); err != nil {
+			return nil, err
+		}
+		if invitation.ID == "" || invitation.Status != InvitationPending {
+			return nil, ErrInvitationInvalid
+		}
+		invitation.Status = status
+		invitation.ClosedAt = time.Now().Unix()
+		return invitation, nil
+	})
+}
+
+// AcceptInvitation marks the invitation as used before the account is set up,
+// so that a link cannot be redeemed twice. It fails with ErrInvitationInvalid
+// if it was used or revoked in the meantime.
+func AcceptInvitation(id string) error {
+	return closeInvitation(id, InvitationAccepted)
+}
+
+// ReopenInvitation makes an accepted invitation usable again, for when setting
+// up the account failed after AcceptInvitation
+func ReopenInvitation(id string) error {
+	return FirebaseDB.NewRef("invitations/"+id).Transaction(context.Background(), func(node db.TransactionNode) (interface{}, error) {
+		var invitation Invitation
+		if err := node.Unmarshal(&invitation); err != nil {
+			return nil, err
+		}
+		if invitation.ID == "" || invitation.Status != InvitationAccepted {
+			return nil, ErrInvitationInvalid
+		}
+		invitation.Status = InvitationPending
+		invitation.ClosedAt = 0
+		invitation.AcceptedBy = ""
+		return invitation, nil
+	})
+}
+
+// SetInvitationAcceptedBy records the account that accepted the invitation
+func SetInvitationAcceptedBy(id, uid string) error {
+	return FirebaseDB.NewRef("invitations/"+id+"/accepted_by").Set(context.Background(), uid)
+}
+
+// RevokeInvitation makes a pending invitation's link unusable
+func RevokeInvitation(id string) error {
+	return closeInvitation(id, InvitationRevoked)
+}
+
+// MergeInvitedRoles adds the invited roles to a user's existing ones. Being
+// invited as an organizer replaces pending_organizer.
+func MergeInvitedRoles(current UserRoles, invited []string) []string {
+	invitedOrganizer := false
+	for _, role := range invited {
+		if role == RoleOrganizer {
+			invitedOrganizer = true
+		}
+	}
+
+	var merged []string
+	seen := make(map[string]bool)
+	for _, list := range [][]string{current.List(), invited} {
+		for _, role := range list {
+			if seen[role] || (invitedOrganizer && role == RolePendingOrganizer) {
+				continue
+			}
+			seen[role] = true
+			merged = append(merged, role)
+		}
+	}
+	return merged
+}
@@ -0,0 +1,31 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMergeInvitedRoles(t *testing.T) {
+	tests := []struct {
+		name    string
+		current UserRoles
+		invited []string
+		want    []string
+	}{
+		{"adds the invited role", NewUserRoles(RoleUser), []string{RoleModerator}, []string{RoleUser, RoleModerator}},
+		{"keeps the primary role first", NewUserRoles(RoleModerator, RoleUser), []string{RoleOrganizer}, []string{RoleModerator, RoleUser, RoleOrganizer}},
+		{"no duplicates", NewUserRoles(RoleUser, RoleOrganizer), []string{RoleOrganizer, RoleUser}, []string{RoleUser, RoleOrganizer}},
+		{"organizer replaces pending_organizer", NewUserRoles(RolePendingOrganizer), []string{RoleOrganizer}, []string{RoleOrganizer}},
+		{"pending_organizer kept for other roles", NewUserRoles(RolePendingOrganizer), []string{RoleModerator}, []string{RolePendingOrganizer, RoleModerator}},
+		{"legacy single role", UserRoles{Role: RoleUser}, []string{RoleOrganizer}, []string{RoleUser, RoleOrganizer}},
+		{"no current roles", UserRoles{}, []string{RoleUser}, []string{RoleUser}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := MergeInvitedRoles(tt.current, tt.invited); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("MergeInvitedRoles(%v, %v) = %v, want %v", tt.current.List(), tt.invited, got, tt.want)
+			}
+		})
+	}
+}
@@ -1,42 +1,115 @@
 package utils
 
 import (
+	"fmt"
 	"log"
+	"os"
+	"strings"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
 )
 
-// Secret key used to sign the JWTs
-var jwtKey = []byte("your_secret_key_here")
+// AccessTokenTTL is the lifetime of the access tokens issued by GenerateJWT.
+// Clients renew them with a refresh token instead of logging in again.
+const AccessTokenTTL = 15 * time.Minute
+
+// ElevatedTokenTTL is the lifetime of the tokens issued after re-authentication
+const ElevatedTokenTTL = 5 * time.Minute
+
+// Principal types; tokens without a principal type belong to end users
+const (
+	PrincipalUser    = "user"
+	PrincipalService = "service"
+)
 
 // Claims struct for JWT payload
 type Claims struct {
-	UID  string `json:"uid"`
-	Role string `json:"role"`
+	UID string `json:"uid"`
+	// UserRoles holds the role and, for users with several, the roles claim
+	UserRoles
+	// SID is the id of the login session the token was issued for
+	SID string `json:"sid,omitempty"`
+	// Scope is a space separated list of the scopes the token was granted
+	Scope string `json:"scope,omitempty"`
+	// PrincipalType is PrincipalService for client credentials tokens, whose
+	// UID is the client id rather than a user
+	PrincipalType string `json:"ptyp,omitempty"`
+	// Org is the active organization; OrgRoles are the user's roles in it
+	Org      string   `json:"org,omitempty"`
+	OrgRoles []string `json:"org_roles,omitempty"`
+	// ClientID is the OAuth client the token was issued to, if any
+	ClientID string `json:"client_id,omitempty"`
+	// AuthTime is when the user last entered their password
+	AuthTime int64 `json:"auth_time,omitempty"`
+	// Act is set on impersonation tokens and names the admin using them
+	Act *Actor `json:"act,omitempty"`
+	// TokenVersion must match the user's token_version for the token to be accepted
+	TokenVersion int64 `json:"tv"`
+	// Source is set to TokenSourceFirebase for Firebase ID tokens; it is never
+	// part of a token we issue
+	Source string `json:"-"`
 	jwt.StandardClaims
 }
 
-// GenerateJWT generates a JWT token for the user
-func GenerateJWT(uid, role string) (string, error) {
+// Actor names the party acting on behalf of the subject (RFC 8693 act claim)
+type Actor struct {
+	Sub string `json:"sub"`
+}
+
+// IsService reports whether the token belongs to a service client rather than
+// an end user
+func (c *Claims) IsService() bool {
+	return c.PrincipalType == PrincipalService
+}
+
+// GenerateJWT signs the claims as an access token. Everything but the standard
+// claims is taken from the caller; those are filled in.
+func GenerateJWT(claims *Claims) (string, error) {
+	return GenerateJWTWithTTL(claims, AccessTokenTTL)
+}
+
+// GenerateJWTWithTTL is GenerateJWT for tokens with a non-default lifetime
+func GenerateJWTWithTTL(claims *Claims, ttl time.Duration) (string, error) {
 	// Set expiration time for the token
-	expirationTime := time.Now().Add(24 * time.Hour) // 24 hours expiration
-
-	// Create JWT claims
-	claims := &Claims{
-		UID:  uid,
-		Role: role,
-		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: expirationTime.Unix(),
-			Issuer:    "Zintrix", // Change this to your app's name
-		},
+	now := time.Now()
+	expirationTime := now.Add(ttl)
+
+	// Every token gets a unique id so it can be revoked on its own
+	jti, err := randomToken(16)
+	if err != nil {
+		return "", err
+	}
+
+	// Fill in the standard JWT claims
+	claims.StandardClaims = jwt.StandardClaims{
+		Id:        jti,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: expirationTime.Unix(),
+		Issuer:    Issuer(),
 	}
 
-	// Create the token with the claims
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return signToken(claims)
+}
 
-	// Sign the token using the secret key
-	tokenString, err := token.SignedString(jwtKey)
+// Issuer is the iss claim of our tokens, JWT_ISSUER or "Zintrix" by default.
+// In OIDC provider mode it must be the public base URL of the server.
+func Issuer() string {
+	if issuer := os.Getenv("JWT_ISSUER"); issuer != "" {
+		return strings.TrimSuffix(issuer, "/")
+	}
+	return "Zintrix"
+}
+
+// signToken signs any set of claims with the active key
+func signToken(claims jwt.Claims) (string, error) {
+	// Create the token with the claims, tagged with the id of the active key
+	key := activeSigningKey()
+	token := jwt.NewWithClaims(key.method, claims)
+	token.Header["kid"] = key.Kid
+
+	// Sign the token using the active key
+	tokenString, err := token.SignedString(key.signKey)
 	if err != nil {
 		log.Printf("Error generating token: %v", err)
 		return "", err
@@ -45,22 +118,36 @@ func GenerateJWT(uid, role string) (string, error) {
 	return tokenString, nil
 }
 
-// VerifyToken verifies the JWT token and returns the claims
+// tokenKey returns the key to verify a token we signed with
+func tokenKey(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, err := verificationKey(kid)
+	if err != nil {
+		return nil, err
+	}
+	// The alg header must match the key, otherwise a public key could be
+	// used as an HMAC secret
+	if token.Method.Alg() != key.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %v for key %q", token.Header["alg"], kid)
+	}
+	return key.verifyKey, nil
+}
+
+// VerifyToken verifies the JWT token and returns the claims. It does not log
+// failures: with Firebase ID tokens enabled, every one of them fails here
+// before being tried as an ID token.
 func VerifyToken(tokenString string) (*Claims, error) {
 	// Parse the token
-	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		return jwtKey, nil
-	})
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, tokenKey)
 	if err != nil {
-		log.Printf("Error parsing token: %v", err)
 		return nil, err
 	}
 
-	// Check if the token is valid
+	// Check if the token is valid. Other tokens we sign, such as ID tokens,
+	// have no uid and are not accepted here.
 	claims, ok := token.Claims.(*Claims)
-	if !ok || !token.Valid {
-		log.Println("Invalid token")
-		return nil, err
+	if !ok || !token.Valid || claims.UID == "" {
+		return nil, fmt.Errorf("invalid token")
 	}
 
 	return claims, nil
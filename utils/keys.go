@@ -0,0 +1,282 @@
+package utils
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// minSecretLength is the shortest HMAC secret we accept (256 bits for HS256)
+const minSecretLength = 32
+
+// Supported values for SigningKey.Alg
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+)
+
+// SigningKey is a single entry of the JWT key set
+type SigningKey struct {
+	Kid string `json:"kid"`
+	// Alg is HS256 (the default), RS256 or EdDSA
+	Alg string `json:"alg,omitempty"`
+	// Secret is the shared secret of an HS256 key
+	Secret string `json:"secret,omitempty"`
+	// PrivateKeyFile is a PEM file holding the RS256 or EdDSA private key.
+	// Retired asymmetric keys may give only PublicKeyFile instead.
+	PrivateKeyFile string `json:"private_key_file,omitempty"`
+	PublicKeyFile  string `json:"public_key_file,omitempty"`
+	// RetireAt ends the key's grace window. A retired key is no longer used to
+	// sign, but tokens it signed keep verifying until this time.
+	RetireAt time.Time `json:"retire_at,omitempty"`
+
+	method    jwt.SigningMethod
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+// KeySet is the format of the file referenced by JWT_KEYS_FILE
+type KeySet struct {
+	ActiveKid string       `json:"active_kid"`
+	Keys      []SigningKey `json:"keys"`
+}
+
+var (
+	keysMu     sync.RWMutex
+	signingKey *SigningKey
+	verifyKeys map[string]*SigningKey
+)
+
+// InitSigningKeys loads the JWT signing keys from JWT_KEYS_FILE or, for a
+// single key setup, from JWT_SIGNING_KEY (HS256) or JWT_PRIVATE_KEY_FILE
+// (RS256/EdDSA, selected with JWT_SIGNING_ALG)
+func InitSigningKeys() {
+	set, err := loadKeySet()
+	if err != nil {
+		log.Fatalf("Error loading JWT signing keys: %v\n", err)
+	}
+	if err := setKeySet(set); err != nil {
+		log.Fatalf("Invalid JWT signing keys: %v\n", err)
+	}
+}
+
+func loadKeySet() (*KeySet, error) {
+	if path := os.Getenv("JWT_KEYS_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var set KeySet
+		if err := json.Unmarshal(data, &set); err != nil {
+			return nil, fmt.Errorf("parsing %s: %v", path, err)
+		}
+		return &set, nil
+	}
+
+	key := SigningKey{
+		Kid:            os.Getenv("JWT_KEY_ID"),
+		Alg:            os.Getenv("JWT_SIGNING_ALG"),
+		Secret:         os.Getenv("JWT_SIGNING_KEY"),
+		PrivateKeyFile: os.Getenv("JWT_PRIVATE_KEY_FILE"),
+	}
+	if key.Secret == "" && key.PrivateKeyFile == "" {
+		return nil, fmt.Errorf("none of JWT_KEYS_FILE, JWT_SIGNING_KEY or JWT_PRIVATE_KEY_FILE is set")
+	}
+	if key.Kid == "" {
+		key.Kid = "default"
+	}
+	return &KeySet{ActiveKid: key.Kid, Keys: []SigningKey{key}}, nil
+}
+
+func setKeySet(set *KeySet) error {
+	keys := make(map[string]*SigningKey, len(set.Keys))
+	for i := range set.Keys {
+		key := &set.Keys[i]
+		if key.Kid == "" {
+			return fmt.Errorf("key %d has no kid", i)
+		}
+		if _, dup := keys[key.Kid]; dup {
+			return fmt.Errorf("duplicate kid %q", key.Kid)
+		}
+		if err := key.load(); err != nil {
+			return fmt.Errorf("key %q: %v", key.Kid, err)
+		}
+		keys[key.Kid] = key
+	}
+
+	active, ok := keys[set.ActiveKid]
+	if !ok {
+		return fmt.Errorf("active kid %q not found in key set", set.ActiveKid)
+	}
+	if active.retired(time.Now()) {
+		return fmt.Errorf("active key %q is already retired", set.ActiveKid)
+	}
+	if active.signKey == nil {
+		return fmt.Errorf("active key %q has no private key", set.ActiveKid)
+	}
+
+	keysMu.Lock()
+	defer keysMu.Unlock()
+	signingKey = active
+	verifyKeys = keys
+	return nil
+}
+
+// load parses the key material according to the key's algorithm
+func (k *SigningKey) load() error {
+	switch k.Alg {
+	case "", AlgHS256:
+		k.Alg = AlgHS256
+		if len(k.Secret) < minSecretLength {
+			return fmt.Errorf("secret must be at least %d bytes", minSecretLength)
+		}
+		k.method = jwt.SigningMethodHS256
+		k.signKey = []byte(k.Secret)
+		k.verifyKey = k.signKey
+
+	case AlgRS256:
+		k.method = jwt.SigningMethodRS256
+		if k.PrivateKeyFile != "" {
+			data, err := os.ReadFile(k.PrivateKeyFile)
+			if err != nil {
+				return err
+			}
+			privateKey, err := jwt.ParseRSAPrivateKeyFromPEM(data)
+			if err != nil {
+				return err
+			}
+			k.signKey = privateKey
+			k.verifyKey = &privateKey.PublicKey
+		} else if k.PublicKeyFile != "" {
+			data, err := os.ReadFile(k.PublicKeyFile)
+			if err != nil {
+				return err
+			}
+			publicKey, err := jwt.ParseRSAPublicKeyFromPEM(data)
+			if err != nil {
+				return err
+			}
+			k.verifyKey = publicKey
+		} else {
+			return fmt.Errorf("private_key_file or public_key_file is required")
+		}
+
+	case AlgEdDSA:
+		k.method = SigningMethodEd25519
+		if k.PrivateKeyFile != "" {
+			parsed, err := parsePEMKey(k.PrivateKeyFile, x509.ParsePKCS8PrivateKey)
+			if err != nil {
+				return err
+			}
+			privateKey, ok := parsed.(ed25519.PrivateKey)
+			if !ok {
+				return fmt.Errorf("%s is not an Ed25519 private key", k.PrivateKeyFile)
+			}
+			k.signKey = privateKey
+			k.verifyKey = privateKey.Public()
+		} else if k.PublicKeyFile != "" {
+			parsed, err := parsePEMKey(k.PublicKeyFile, x509.ParsePKIXPublicKey)
+			if err != nil {
+				return err
+			}
+			publicKey, ok := parsed.(ed25519.PublicKey)
+			if !ok {
+				return fmt.Errorf("%s is not an Ed25519 public key", k.PublicKeyFile)
+			}
+			k.verifyKey = publicKey
+		} else {
+			return fmt.Errorf("private_key_file or public_key_file is required")
+		}
+
+	default:
+		return fmt.Errorf("unsupported alg %q", k.Alg)
+	}
+	return nil
+}
+
+func parsePEMKey(path string, parse func([]byte) (interface{}, error)) (interface{}, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s does not contain a PEM block", path)
+	}
+	return parse(block.Bytes)
+}
+
+func (k *SigningKey) retired(now time.Time) bool {
+	return !k.RetireAt.IsZero() && !now.Before(k.RetireAt)
+}
+
+// activeSigningKey returns the key new tokens are signed with
+func activeSigningKey() *SigningKey {
+	keysMu.RLock()
+	defer keysMu.RUnlock()
+	return signingKey
+}
+
+// verificationKey returns the key with the given kid if it is still within
+// its grace window
+func verificationKey(kid string) (*SigningKey, error) {
+	keysMu.RLock()
+	key, ok := verifyKeys[kid]
+	keysMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	if key.retired(time.Now()) {
+		return nil, fmt.Errorf("signing key %q has been retired", kid)
+	}
+	return key, nil
+}
+
+// PublicJWKS returns the public halves of all asymmetric keys that are still
+// within their grace window, in JSON Web Key format (RFC 7517). HMAC keys are
+// never published.
+func PublicJWKS() []map[string]string {
+	keysMu.RLock()
+	defer keysMu.RUnlock()
+
+	now := time.Now()
+	jwks := []map[string]string{}
+	for _, key := range verifyKeys {
+		if key.retired(now) {
+			continue
+		}
+		switch publicKey := key.verifyKey.(type) {
+		case *rsa.PublicKey:
+			jwks = append(jwks, map[string]string{
+				"kty": "RSA",
+				"use": "sig",
+				"alg": key.Alg,
+				"kid": key.Kid,
+				"n":   base64.RawURLEncoding.EncodeToString(publicKey.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			jwks = append(jwks, map[string]string{
+				"kty": "OKP",
+				"crv": "Ed25519",
+				"use": "sig",
+				"alg": key.Alg,
+				"kid": key.Kid,
+				"x":   base64.RawURLEncoding.EncodeToString(publicKey),
+			})
+		}
+	}
+	return jwks
+}
@@ -3,8 +3,10 @@ package utils
 import (
 	"context"
 	"fmt"
+	"html"
 	"net/smtp"
 	"os"
+	"time"
 
 	"firebase.google.com/go/auth"
 )
@@ -126,3 +128,42 @@ func ResendVerificationEmail(email string) error {
 
 	return nil
 }
+
+// SendOrganizerDecisionEmail tells an applicant whether their organizer
+// request was approved
+func SendOrganizerDecisionEmail(email string, approved bool, reason string) error {
+	subject := "Your organizer request was approved"
+	body := "<p>Your request to become an organizer has been approved. Log in again to start using your organizer account.</p>"
+	if !approved {
+		subject = "Your organizer request was not approved"
+		body = "<p>Your request to become an organizer has not been approved. You can keep using your account as a regular user.</p>"
+	}
+	if reason != "" {
+		body += fmt.Sprintf("<p>Reason: %s</p>", html.EscapeString(reason))
+	}
+
+	err := SendEmail(email, subject, body)
+	if err != nil {
+		return fmt.Errorf("error sending organizer decision email: %v", err)
+	}
+
+	return nil
+}
+
+// SendInvitationEmail sends an invitation link. inviter is the name shown as
+// the sender of the invitation and may be empty.
+func SendInvitationEmail(email, inviter, link string, expiresAt time.Time) error {
+	from := "You have"
+	if inviter != "" {
+		from = html.EscapeString(inviter) + " has"
+	}
+	body := fmt.Sprintf("<p>%s invited you to join the team.</p><p><a href=\"%s\">Accept the invitation</a></p><p>The link can be used once and expires on %s.</p>",
+		from, html.EscapeString(link), expiresAt.UTC().Format("January 2, 2006"))
+
+	err := SendEmail(email, "You have been invited", body)
+	if err != nil {
+		return fmt.Errorf("error sending invitation email: %v", err)
+	}
+
+	return nil
+}
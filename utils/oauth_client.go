@@ -0,0 +1,125 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var ErrClientInvalid = errors.New("invalid client credentials")
+
+// Grant types a client can be registered for
+const (
+	GrantAuthorizationCode = "authorization_code"
+	GrantClientCredentials = "client_credentials"
+)
+
+// OAuthClient is a registered API client, stored under oauth_clients/{id}
+// with a bcrypt hash of its secret
+type OAuthClient struct {
+	ID         string `json:"id"`
+	Name       string `json:"name"`
+	SecretHash string `json:"secret_hash,omitempty"`
+	// Public clients (mobile and single page apps) have no secret and
+	// authenticate with PKCE alone
+	Public       bool     `json:"public,omitempty"`
+	GrantTypes   []string `json:"grant_types,omitempty"`
+	RedirectURIs []string `json:"redirect_uris,omitempty"`
+	// Scopes the client may request for its own service tokens
+	Scopes []string `json:"scopes,omitempty"`
+	// Org binds the client's service tokens to an organization, so they only
+	// reach its members. Unbound clients only reach users outside any org.
+	Org string `json:"org,omitempty"`
+	// CanIntrospect allows the client to call /oauth/introspect
+	CanIntrospect bool  `json:"can_introspect"`
+	CreatedAt     int64 `json:"created_at"`
+}
+
+// AllowsGrant reports whether the client is registered for the grant type
+func (c *OAuthClient) AllowsGrant(grantType string) bool {
+	for _, g := range c.GrantTypes {
+		if g == grantType {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsScope reports whether the client may request the scope for a
+// client credentials token
+func (c *OAuthClient) AllowsScope(scope string) bool {
+	for _, s := range c.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// HasRedirectURI reports whether uri exactly matches a registered redirect URI
+func (c *OAuthClient) HasRedirectURI(uri string) bool {
+	for _, u := range c.RedirectURIs {
+		if u == uri {
+			return true
+		}
+	}
+	return false
+}
+
+// GetOAuthClient returns the client, or nil if it does not exist
+func GetOAuthClient(id string) (*OAuthClient, error) {
+	var client OAuthClient
+	if err := FirebaseDB.NewRef("oauth_clients/"+id).Get(context.Background(), &client); err != nil {
+		return nil, err
+	}
+	if client.ID == "" {
+		return nil, nil
+	}
+	return &client, nil
+}
+
+// AuthenticateClient checks a client id and secret pair
+func AuthenticateClient(id, secret string) (*OAuthClient, error) {
+	if id == "" || secret == "" {
+		return nil, ErrClientInvalid
+	}
+
+	client, err := GetOAuthClient(id)
+	if err != nil {
+		return nil, err
+	}
+	if client == nil || client.Public || bcrypt.CompareHashAndPassword([]byte(client.SecretHash), []byte(secret)) != nil {
+		return nil, ErrClientInvalid
+	}
+	return client, nil
+}
+
+// CreateOAuthClient registers a new client and returns its secret, which is
+// not stored anywhere in plain text. Public clients get no secret.
+func CreateOAuthClient(client *OAuthClient) (string, error) {
+	id, err := randomToken(12)
+	if err != nil {
+		return "", err
+	}
+	client.ID = id
+
+	var secret string
+	if !client.Public {
+		if secret, err = randomToken(32); err != nil {
+			return "", err
+		}
+		secretHash, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.DefaultCost)
+		if err != nil {
+			return "", err
+		}
+		client.SecretHash = string(secretHash)
+	}
+
+	client.CreatedAt = time.Now().Unix()
+	if err := FirebaseDB.NewRef("oauth_clients/"+id).Set(context.Background(), client); err != nil {
+		return "", err
+	}
+	return secret, nil
+}
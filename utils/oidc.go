@@ -0,0 +1,175 @@
+package utils
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"firebase.google.com/go/db"
+	"github.com/dgrijalva/jwt-go"
+)
+
+// OpenID Connect scopes, requested by relying parties next to our own scopes
+const (
+	OIDCScopeOpenID  = "openid"
+	OIDCScopeProfile = "profile"
+	OIDCScopeEmail   = "email"
+)
+
+// OIDCScopes lists the OpenID Connect scopes we support
+var OIDCScopes = []string{OIDCScopeOpenID, OIDCScopeProfile, OIDCScopeEmail}
+
+// AuthorizationCodeTTL is how long an authorization code can be redeemed
+const AuthorizationCodeTTL = time.Minute
+
+var ErrAuthorizationCodeInvalid = errors.New("invalid or expired authorization code")
+
+// AuthorizationCode is stored under oauth_codes/{hash} until it is redeemed
+// at the token endpoint
+type AuthorizationCode struct {
+	ClientID      string `json:"client_id"`
+	UID           string `json:"uid"`
+	RedirectURI   string `json:"redirect_uri"`
+	Scope         string `json:"scope"`
+	Nonce         string `json:"nonce,omitempty"`
+	CodeChallenge string `json:"code_challenge"`
+	AuthTime      int64  `json:"auth_time"`
+	ExpiresAt     int64  `json:"expires_at"`
+}
+
+// IDTokenClaims is the payload of an OpenID Connect ID token
+type IDTokenClaims struct {
+	AuthTime      int64  `json:"auth_time,omitempty"`
+	Nonce         string `json:"nonce,omitempty"`
+	Role          string `json:"role"`
+	Email         string `json:"email,omitempty"`
+	EmailVerified bool   `json:"email_verified,omitempty"`
+	Name          string `json:"name,omitempty"`
+	jwt.StandardClaims
+}
+
+// IsOIDCScope reports whether scope is one of OIDCScopes
+func IsOIDCScope(scope string) bool {
+	for _, s := range OIDCScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateAuthorizationCode stores the code's grant and returns the code
+func CreateAuthorizationCode(grant *AuthorizationCode) (string, error) {
+	code, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	grant.ExpiresAt = time.Now().Add(AuthorizationCodeTTL).Unix()
+	if err := FirebaseDB.NewRef("oauth_codes/"+hashToken(code)).Set(context.Background(), grant); err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+// ConsumeAuthorizationCode deletes the code and returns its grant. A code can
+// only be redeemed once.
+func ConsumeAuthorizationCode(code string) (*AuthorizationCode, error) {
+	var grant AuthorizationCode
+	err := FirebaseDB.NewRef("oauth_codes/"+hashToken(code)).Transaction(context.Background(), func(node db.TransactionNode) (interface{}, error) {
+		grant = AuthorizationCode{}
+		if err := node.Unmarshal(&grant); err != nil || grant.ClientID == "" {
+			return nil, ErrAuthorizationCodeInvalid
+		}
+		return nil, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if time.Now().Unix() >= grant.ExpiresAt {
+		return nil, ErrAuthorizationCodeInvalid
+	}
+	return &grant, nil
+}
+
+// VerifyPKCE checks a code_verifier against an S256 code_challenge (RFC 7636)
+func VerifyPKCE(verifier, challenge string) bool {
+	sum := sha256.Sum256([]byte(verifier))
+	expected := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) == 1
+}
+
+// PruneAuthorizationCodes removes codes that expired without being redeemed.
+// It relies on an ".indexOn": "expires_at" rule for oauth_codes.
+func PruneAuthorizationCodes() error {
+	var expired map[string]AuthorizationCode
+	err := FirebaseDB.NewRef("oauth_codes").OrderByChild("expires_at").EndAt(time.Now().Unix()).Get(context.Background(), &expired)
+	if err != nil || len(expired) == 0 {
+		return err
+	}
+
+	updates := make(map[string]interface{}, len(expired))
+	for hash := range expired {
+		updates[hash] = nil
+	}
+	return FirebaseDB.NewRef("oauth_codes").Update(context.Background(), updates)
+}
+
+// OIDCProviderEnabled reports whether the OpenID Connect provider routes are
+// served (OIDC_PROVIDER=true)
+func OIDCProviderEnabled() bool {
+	return os.Getenv("OIDC_PROVIDER") == "true"
+}
+
+// CheckOIDCSigningKey returns an error unless relying parties can verify our
+// ID tokens against the JWKS. An HS256 key is the server's own secret, so the
+// active key must be RS256 or EdDSA.
+func CheckOIDCSigningKey() error {
+	if alg := SigningAlg(); alg != AlgRS256 && alg != AlgEdDSA {
+		return fmt.Errorf("ID tokens need an RS256 or EdDSA signing key, the active key is %s", alg)
+	}
+	return nil
+}
+
+// GenerateIDToken signs an ID token for the client. The audience, subject and
+// timestamps are filled in.
+func GenerateIDToken(clientID, uid string, claims *IDTokenClaims) (string, error) {
+	if err := CheckOIDCSigningKey(); err != nil {
+		return "", err
+	}
+	now := time.Now()
+	claims.StandardClaims = jwt.StandardClaims{
+		Issuer:    Issuer(),
+		Subject:   uid,
+		Audience:  clientID,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(AccessTokenTTL).Unix(),
+	}
+	return signToken(claims)
+}
+
+// SigningAlg is the alg of the active signing key
+func SigningAlg() string {
+	return activeSigningKey().Alg
+}
+
+// SplitScope splits a scope parameter into our own and OpenID Connect scopes,
+// dropping anything unknown. Third-party clients are never granted the account
+// or admin scope.
+func SplitScope(scope string) (apiScopes, oidcScopes []string) {
+	for _, s := range strings.Fields(scope) {
+		switch {
+		case IsOIDCScope(s):
+			oidcScopes = append(oidcScopes, s)
+		case IsDelegableScope(s):
+			apiScopes = append(apiScopes, s)
+		}
+	}
+	return apiScopes, oidcScopes
+}
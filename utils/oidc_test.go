@@ -0,0 +1,59 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestVerifyPKCE(t *testing.T) {
+	const (
+		verifier  = "dBjftJeZ4CVP-mJ92IhsFL9kdJ5jDm8KlpKfaEyFQdGA"
+		challenge = "ALeAd1iBrgpMAB1CXaiTPa-SANgYN4pMsiRqpvx7obw"
+	)
+
+	tests := []struct {
+		name      string
+		verifier  string
+		challenge string
+		want      bool
+	}{
+		{"matching verifier", verifier, challenge, true},
+		{"other verifier", verifier + "x", challenge, false},
+		{"plain challenge", verifier, verifier, false},
+		{"padded challenge", verifier, challenge + "=", false},
+		{"empty verifier", "", challenge, false},
+		{"empty challenge", verifier, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := VerifyPKCE(tt.verifier, tt.challenge); got != tt.want {
+				t.Errorf("VerifyPKCE() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitScope(t *testing.T) {
+	tests := []struct {
+		name     string
+		scope    string
+		wantAPI  []string
+		wantOIDC []string
+	}{
+		{"empty", "", nil, nil},
+		{"both kinds", "openid profile:read email", []string{ScopeProfileRead}, []string{OIDCScopeOpenID, OIDCScopeEmail}},
+		{"account is never granted", "openid account", nil, []string{OIDCScopeOpenID}},
+		{"admin is never granted", "admin profile:write", []string{ScopeProfileWrite}, nil},
+		{"unknown scopes dropped", "openid offline_access", nil, []string{OIDCScopeOpenID}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api, oidc := SplitScope(tt.scope)
+			if !reflect.DeepEqual(api, tt.wantAPI) || !reflect.DeepEqual(oidc, tt.wantOIDC) {
+				t.Errorf("SplitScope(%q) = %v, %v, want %v, %v", tt.scope, api, oidc, tt.wantAPI, tt.wantOIDC)
+			}
+		})
+	}
+}
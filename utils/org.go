@@ -0,0 +1,313 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	ErrNotOrgMember = errors.New("not a member of the organization")
+	ErrLastOrgAdmin = errors.New("an organization needs at least one admin")
+)
+
+// Org is an organization (tenant), stored under orgs/{id}
+type Org struct {
+	ID        string `json:"id"`
+	Name      string `json:"name"`
+	CreatedAt int64  `json:"created_at"`
+	CreatedBy string `json:"created_by"`
+}
+
+// OrgMember is a membership record, stored under org_members/{org}/{uid}.
+// The roles only apply while the org is the token's active org. The org ids
+// of a user are indexed under users/{uid}/orgs.
+type OrgMember struct {
+	UID      string   `json:"uid"`
+	Roles    []string `json:"roles"`
+	JoinedAt int64    `json:"joined_at"`
+}
+
+func orgMemberPath(org, uid string) string {
+	return "org_members/" + org + "/" + uid
+}
+
+// CreateOrg creates an organization with the creator as its admin
+func CreateOrg(name, creator string) (*Org, error) {
+	id, err := randomToken(9)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().Unix()
+	org := &Org{ID: id, Name: name, CreatedAt: now, CreatedBy: creator}
+	member := &OrgMember{UID: creator, Roles: []string{RoleAdmin}, JoinedAt: now}
+	err = FirebaseDB.NewRef("").Update(context.Background(), map[string]interface{}{
+		"orgs/" + id:                       org,
+		orgMemberPath(id, creator):         member,
+		"users/" + creator + "/orgs/" + id: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return org, nil
+}
+
+// GetOrg returns the organization, or nil if it does not exist
+func GetOrg(id string) (*Org, error) {
+	var org Org
+	if err := FirebaseDB.NewRef("orgs/"+id).Get(context.Background(), &org); err != nil {
+		return nil, err
+	}
+	if org.ID == "" {
+		return nil, nil
+	}
+	return &org, nil
+}
+
+// GetOrgMember returns the user's membership of the org, or nil if the user
+// is not a member
+func GetOrgMember(org, uid string) (*OrgMember, error) {
+	var member OrgMember
+	if err := FirebaseDB.NewRef(orgMemberPath(org, uid)).Get(context.Background(), &member); err != nil {
+		return nil, err
+	}
+	if member.UID == "" {
+		return nil, nil
+	}
+	return &member, nil
+}
+
+// ListOrgMembers returns the members of the org, oldest first
+func ListOrgMembers(org string) ([]OrgMember, error) {
+	var members map[string]OrgMember
+	if err := FirebaseDB.NewRef("org_members/"+org).Get(context.Background(), &members); err != nil {
+		return nil, err
+	}
+
+	list := make([]OrgMember, 0, len(members))
+	for _, m := range members {
+		list = append(list, m)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].JoinedAt < list[j].JoinedAt })
+	return list, nil
+}
+
+// ListUserOrgs returns the ids of the orgs the user belongs to
+func ListUserOrgs(uid string) ([]string, error) {
+	var orgs map[string]bool
+	if err := FirebaseDB.NewRef("users/"+uid+"/orgs").Get(context.Background(), &orgs); err != nil {
+		return nil, err
+	}
+
+	list := make([]string, 0, len(orgs))
+	for id := range orgs {
+		list = append(list, id)
+	}
+	sort.Strings(list)
+	return list, nil
+}
+
+// SetOrgMember adds the user to the org or changes the user's roles in it.
+// When an existing member's roles change, the tokens issued for the org
+// before the change stop working (see CheckOrgMembership); tokens for other
+// orgs or without an org are left alone.
+func SetOrgMember(org, uid string, roles []string) error {
+	joinedAt := time.Now().Unix()
+	existing, err := GetOrgMember(org, uid)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		if sameRoles(existing.Roles, roles) {
+			return nil
+		}
+		joinedAt = existing.JoinedAt
+	}
+
+	err = FirebaseDB.NewRef("").Update(context.Background(), map[string]interface{}{
+		orgMemberPath(org, uid):         &OrgMember{UID: uid, Roles: roles, JoinedAt: joinedAt},
+		"users/" + uid + "/orgs/" + org: true,
+	})
+	if err != nil {
+		return err
+	}
+	cacheOrgMember(org, uid, orgMemberEntry{member: true, roles: roles})
+	return nil
+}
+
+// RemoveOrgMember removes the user from the org. Tokens issued for the org
+// stop working; on refresh, sessions that had it active fall back to no
+// active org.
+func RemoveOrgMember(org, uid string) error {
+	err := FirebaseDB.NewRef("").Update(context.Background(), map[string]interface{}{
+		orgMemberPath(org, uid):         nil,
+		"users/" + uid + "/orgs/" + org: nil,
+	})
+	if err != nil {
+		return err
+	}
+	cacheOrgMember(org, uid, orgMemberEntry{})
+	return nil
+}
+
+// CheckOrgMembership returns ErrTokenRevoked if the user has left the token's
+// active org, or their roles in it have changed, since the token was issued.
+// Like token versions, memberships are cached for tokenVersionCacheTTL.
+func CheckOrgMembership(claims *Claims) error {
+	// Service tokens bound to an org hold no roles in it
+	if claims.Org == "" || claims.IsService() {
+		return nil
+	}
+
+	orgMemberMu.Lock()
+	entry, ok := orgMemberCache[orgMemberPath(claims.Org, claims.UID)]
+	orgMemberMu.Unlock()
+
+	if !ok || !time.Now().Before(entry.until) {
+		member, err := GetOrgMember(claims.Org, claims.UID)
+		if err != nil {
+			return err
+		}
+		entry = orgMemberEntry{}
+		if member != nil {
+			entry = orgMemberEntry{member: true, roles: member.Roles}
+		}
+		cacheOrgMember(claims.Org, claims.UID, entry)
+	}
+
+	if !entry.member || !sameRoles(entry.roles, claims.OrgRoles) {
+		return ErrTokenRevoked
+	}
+	return nil
+}
+
+type orgMemberEntry struct {
+	member bool
+	roles  []string
+	until  time.Time
+}
+
+var (
+	orgMemberMu    sync.Mutex
+	orgMemberCache = make(map[string]orgMemberEntry)
+)
+
+func cacheOrgMember(org, uid string, entry orgMemberEntry) {
+	entry.until = time.Now().Add(tokenVersionCacheTTL)
+	orgMemberMu.Lock()
+	orgMemberCache[orgMemberPath(org, uid)] = entry
+	orgMemberMu.Unlock()
+}
+
+// CheckOrgKeepsAdmin returns ErrLastOrgAdmin if giving the user the roles
+// (nil for removing the user) would leave the org without an admin
+func CheckOrgKeepsAdmin(org, uid string, roles []string) error {
+	if NewUserRoles(roles...).HasRole(RoleAdmin) {
+		return nil
+	}
+	members, err := ListOrgMembers(org)
+	if err != nil {
+		return err
+	}
+	for _, m := range members {
+		if m.UID != uid && NewUserRoles(m.Roles...).HasRole(RoleAdmin) {
+			return nil
+		}
+	}
+	return ErrLastOrgAdmin
+}
+
+func sameRoles(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// OrgRolesFor returns the user's roles in the org, or ErrNotOrgMember
+func OrgRolesFor(org, uid string) ([]string, error) {
+	member, err := GetOrgMember(org, uid)
+	if err != nil {
+		return nil, err
+	}
+	if member == nil {
+		return nil, ErrNotOrgMember
+	}
+	return member.Roles, nil
+}
+
+// OrgUserRoles returns the roles the token holds in its active org
+func (c *Claims) OrgUserRoles() UserRoles {
+	return NewUserRoles(c.OrgRoles...)
+}
+
+// TenantScope decides which users a caller may reach. A token with an active
+// org only reaches that org's members. Without one, users who belong to
+// organizations are only reachable by fellow members and by global admins,
+// who operate the platform across tenants; users outside any org are
+// reachable by everyone.
+type TenantScope struct {
+	all     bool
+	members map[string]bool // members of the active org
+	orgs    map[string]bool // orgs of the caller, without an active org
+}
+
+// NewTenantScope returns the scope of the caller
+func NewTenantScope(claims *Claims) (*TenantScope, error) {
+	if claims.Org != "" {
+		members, err := ListOrgMembers(claims.Org)
+		if err != nil {
+			return nil, err
+		}
+		scope := &TenantScope{members: make(map[string]bool, len(members))}
+		for _, m := range members {
+			scope.members[m.UID] = true
+		}
+		return scope, nil
+	}
+
+	if claims.HasRole(RoleAdmin) {
+		return &TenantScope{all: true}, nil
+	}
+	orgs, err := ListUserOrgs(claims.UID)
+	if err != nil {
+		return nil, err
+	}
+	scope := &TenantScope{orgs: make(map[string]bool, len(orgs))}
+	for _, org := range orgs {
+		scope.orgs[org] = true
+	}
+	return scope, nil
+}
+
+// Includes reports whether the user is within the scope
+func (s *TenantScope) Includes(uid string) (bool, error) {
+	if s.all {
+		return true, nil
+	}
+	if s.members != nil {
+		return s.members[uid], nil
+	}
+
+	orgs, err := ListUserOrgs(uid)
+	if err != nil {
+		return false, err
+	}
+	if len(orgs) == 0 {
+		return true, nil
+	}
+	for _, org := range orgs {
+		if s.orgs[org] {
+			return true, nil
+		}
+	}
+	return false, nil
+}
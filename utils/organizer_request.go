@@ -0,0 +1,154 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"firebase.google.com/go/db"
+)
+
+// Statuses of an organizer request
+const (
+	OrganizerRequestPending  = "pending"
+	OrganizerRequestApproved = "approved"
+	OrganizerRequestRejected = "rejected"
+)
+
+var ErrOrganizerRequestReviewed = errors.New("organizer request has already been reviewed")
+
+// OrganizerRequest is an entry of the approvals queue, stored under
+// organizer_requests/{uid}
+type OrganizerRequest struct {
+	UID         string `json:"uid"`
+	Email       string `json:"email"`
+	Name        string `json:"name,omitempty"`
+	Status      string `json:"status"`
+	RequestedAt int64  `json:"requested_at"`
+	ReviewedAt  int64  `json:"reviewed_at,omitempty"`
+	ReviewedBy  string `json:"reviewed_by,omitempty"`
+	Reason      string `json:"reason,omitempty"`
+}
+
+func organizerRequestRef(uid string) *db.Ref {
+	return FirebaseDB.NewRef("organizer_requests/" + uid)
+}
+
+// CreateOrganizerRequest queues the user's request to become an organizer
+func CreateOrganizerRequest(uid, email, name string) error {
+	return organizerRequestRef(uid).Set(context.Background(), &OrganizerRequest{
+		UID:         uid,
+		Email:       email,
+		Name:        name,
+		Status:      OrganizerRequestPending,
+		RequestedAt: time.Now().Unix(),
+	})
+}
+
+// GetOrganizerRequest returns the user's request, or nil if there is none
+func GetOrganizerRequest(uid string) (*OrganizerRequest, error) {
+	var request OrganizerRequest
+	if err := organizerRequestRef(uid).Get(context.Background(), &request); err != nil {
+		return nil, err
+	}
+	if request.UID == "" {
+		return nil, nil
+	}
+	return &request, nil
+}
+
+// ListOrganizerRequests returns the requests with the given status
+func ListOrganizerRequests(status string) ([]OrganizerRequest, error) {
+	var requests map[string]OrganizerRequest
+	err := FirebaseDB.NewRef("organizer_requests").OrderByChild("status").EqualTo(status).Get(context.Background(), &requests)
+	if err != nil {
+		return nil, err
+	}
+
+	list := make([]OrganizerRequest, 0, len(requests))
+	for _, request := range requests {
+		list = append(list, request)
+	}
+	return list, nil
+}
+
+// ReviewOrganizerRequest approves or rejects a pending request and updates
+// the user's roles: approval turns pending_organizer into organizer, and
+// rejection drops it, leaving the user with the user role. If the roles
+// cannot be updated, the request goes back to pending so it can be reviewed
+// again.
+func ReviewOrganizerRequest(uid, reviewer string, approve bool, reason string) (*OrganizerRequest, error) {
+	var request OrganizerRequest
+	err := organizerRequestRef(uid).Transaction(context.Background(), func(node db.TransactionNode) (interface{}, error) {
+		request = OrganizerRequest{}
+		if err := node.Unmarshal(&request); err != nil {
+			return nil, err
+		}
+		if request.Status != OrganizerRequestPending {
+			return nil, ErrOrganizerRequestReviewed
+		}
+		request.Status = OrganizerRequestRejected
+		if approve {
+			request.Status = OrganizerRequestApproved
+		}
+		request.ReviewedAt = time.Now().Unix()
+		request.ReviewedBy = reviewer
+		request.Reason = reason
+		return &request, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := applyOrganizerDecision(uid, approve); err != nil {
+		if reopenErr := reopenOrganizerRequest(uid); reopenErr != nil {
+			log.Printf("Failed to reopen organizer request: %v", reopenErr)
+		}
+		return nil, err
+	}
+	return &request, nil
+}
+
+// applyOrganizerDecision sets the user's roles to the outcome of the review
+func applyOrganizerDecision(uid string, approve bool) error {
+	current, err := GetUserRoles(uid)
+	if err != nil {
+		return err
+	}
+	return SetUserRoles(uid, organizerDecisionRoles(current.List(), approve))
+}
+
+// organizerDecisionRoles derives the roles from the decision alone rather
+// than from what the current ones suggest: a review that failed half way may
+// have stored organizer already, and rejecting after reopening must still
+// take it away. Approving puts organizer where pending_organizer was.
+func organizerDecisionRoles(current []string, approve bool) []string {
+	var roles []string
+	granted := false
+	for _, role := range current {
+		if role != RolePendingOrganizer && role != RoleOrganizer {
+			roles = append(roles, role)
+		} else if approve && !granted {
+			roles = append(roles, RoleOrganizer)
+			granted = true
+		}
+	}
+	if approve && !granted {
+		roles = append(roles, RoleOrganizer)
+	}
+	if len(roles) == 0 {
+		roles = []string{RoleUser}
+	}
+	return roles
+}
+
+// reopenOrganizerRequest undoes the review of a request
+func reopenOrganizerRequest(uid string) error {
+	return organizerRequestRef(uid).Update(context.Background(), map[string]interface{}{
+		"status":      OrganizerRequestPending,
+		"reviewed_at": nil,
+		"reviewed_by": nil,
+		"reason":      nil,
+	})
+}
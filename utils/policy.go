@@ -0,0 +1,227 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// policyReloadInterval is how often the policy file is checked for changes
+const policyReloadInterval = 5 * time.Second
+
+// PolicyRule grants access to a route. Roles are alternatives, permissions
+// are all required. A rule with neither must set AnyAuthenticated, so that
+// opening a route to every caller is always explicit. Org rules need a token
+// with an active org and check the roles held in that org instead.
+type PolicyRule struct {
+	// Method is an HTTP method or "*" for all of them
+	Method string `json:"method"`
+	// Path is the mux path template of the route, e.g. "/user/sessions/{id}"
+	Path             string   `json:"path"`
+	Roles            []string `json:"roles,omitempty"`
+	Permissions      []string `json:"permissions,omitempty"`
+	AnyAuthenticated bool     `json:"any_authenticated,omitempty"`
+	Org              bool     `json:"org,omitempty"`
+}
+
+// Policy is the format of the file referenced by AUTH_POLICY_FILE. Routes
+// guarded by the policy that have no rule are denied. Attributes holds the
+// rules Authorize evaluates for finer grained checks within a route.
+type Policy struct {
+	Rules      []PolicyRule    `json:"rules"`
+	Attributes []AttributeRule `json:"attributes,omitempty"`
+}
+
+var (
+	policyMu sync.RWMutex
+	policy   *Policy
+)
+
+// Rule returns the rule for the route, preferring a rule for the exact method
+// over a "*" rule
+func (p *Policy) Rule(method, path string) *PolicyRule {
+	var wildcard *PolicyRule
+	for i := range p.Rules {
+		rule := &p.Rules[i]
+		if rule.Path != path {
+			continue
+		}
+		if rule.Method == method {
+			return rule
+		}
+		if rule.Method == "*" && wildcard == nil {
+			wildcard = rule
+		}
+	}
+	return wildcard
+}
+
+// Allows reports whether the claims satisfy the rule
+func (rule *PolicyRule) Allows(claims *Claims) bool {
+	roles := claims.UserRoles
+	if rule.Org {
+		if claims.Org == "" {
+			return false
+		}
+		roles = claims.OrgUserRoles()
+	}
+	if len(rule.Roles) > 0 && !roles.HasRole(rule.Roles...) {
+		return false
+	}
+	for _, permission := range rule.Permissions {
+		if !roles.HasPermission(permission) {
+			return false
+		}
+	}
+	return true
+}
+
+// Requirement describes the rule in the message of a 403
+func (rule *PolicyRule) Requirement() string {
+	var parts []string
+	if len(rule.Roles) > 0 {
+		parts = append(parts, "role "+strings.Join(rule.Roles, " or "))
+	}
+	if len(rule.Permissions) > 0 {
+		parts = append(parts, "permission "+strings.Join(rule.Permissions, " and "))
+	}
+	requirement := strings.Join(parts, " with ")
+	if rule.Org {
+		if requirement == "" {
+			return "an active organization"
+		}
+		requirement += " in the active organization"
+	}
+	return requirement
+}
+
+// validate checks that every rule is well formed and only names known roles
+// and permissions
+func (p *Policy) validate() error {
+	seen := make(map[string]bool, len(p.Rules))
+	for i, rule := range p.Rules {
+		switch rule.Method {
+		case "*", "GET", "HEAD", "POST", "PUT", "PATCH", "DELETE":
+		default:
+			return fmt.Errorf("rule %d: unsupported method %q", i, rule.Method)
+		}
+		if !strings.HasPrefix(rule.Path, "/") {
+			return fmt.Errorf("rule %d: path %q must start with /", i, rule.Path)
+		}
+		key := rule.Method + " " + rule.Path
+		if seen[key] {
+			return fmt.Errorf("rule %d: duplicate rule for %s", i, key)
+		}
+		seen[key] = true
+		if len(rule.Roles) == 0 && len(rule.Permissions) == 0 && !rule.AnyAuthenticated {
+			return fmt.Errorf("rule %d: %s names no roles or permissions and does not set any_authenticated", i, key)
+		}
+		for _, role := range rule.Roles {
+			if !IsKnownRole(role) {
+				return fmt.Errorf("rule %d: unknown role %q", i, role)
+			}
+		}
+		for _, permission := range rule.Permissions {
+			if !IsKnownPermission(permission) {
+				return fmt.Errorf("rule %d: unknown permission %q", i, permission)
+			}
+		}
+	}
+
+	ids := make(map[string]bool, len(p.Attributes))
+	for i := range p.Attributes {
+		rule := &p.Attributes[i]
+		if err := rule.validate(); err != nil {
+			return err
+		}
+		if ids[rule.ID] {
+			return fmt.Errorf("duplicate attribute rule %s", rule.ID)
+		}
+		ids[rule.ID] = true
+	}
+	return nil
+}
+
+// InitPolicy loads the authorization policy from AUTH_POLICY_FILE
+// (policy.json by default) and reloads it whenever the file changes. check
+// is run on every version of the policy before it is used, e.g. to make sure
+// it covers the registered routes; a reload that fails it is logged and the
+// previous policy stays in place.
+func InitPolicy(check func(*Policy) error) {
+	path := os.Getenv("AUTH_POLICY_FILE")
+	if path == "" {
+		path = "policy.json"
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		log.Fatalf("Error loading authorization policy: %v\n", err)
+	}
+	p, err := loadPolicy(path, check)
+	if err != nil {
+		log.Fatalf("Invalid authorization policy: %v\n", err)
+	}
+	setPolicy(p)
+
+	go watchPolicy(path, info.ModTime(), check)
+}
+
+// watchPolicy polls the policy file and swaps in new versions
+func watchPolicy(path string, modTime time.Time, check func(*Policy) error) {
+	for range time.Tick(policyReloadInterval) {
+		info, err := os.Stat(path)
+		if err != nil {
+			log.Printf("Failed to check authorization policy: %v\n", err)
+			continue
+		}
+		if info.ModTime().Equal(modTime) {
+			continue
+		}
+		modTime = info.ModTime()
+
+		p, err := loadPolicy(path, check)
+		if err != nil {
+			log.Printf("Keeping the previous authorization policy, reload failed: %v\n", err)
+			continue
+		}
+		setPolicy(p)
+		log.Printf("Reloaded authorization policy from %s\n", path)
+	}
+}
+
+func loadPolicy(path string, check func(*Policy) error) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var p Policy
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, err
+	}
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+	if check != nil {
+		if err := check(&p); err != nil {
+			return nil, err
+		}
+	}
+	return &p, nil
+}
+
+func setPolicy(p *Policy) {
+	policyMu.Lock()
+	defer policyMu.Unlock()
+	policy = p
+}
+
+// CurrentPolicy returns the policy in effect
+func CurrentPolicy() *Policy {
+	policyMu.RLock()
+	defer policyMu.RUnlock()
+	return policy
+}
@@ -0,0 +1,111 @@
+package utils
+
+import "testing"
+
+func TestPolicyRule(t *testing.T) {
+	p := &Policy{Rules: []PolicyRule{
+		{Method: "*", Path: "/user/api-keys", Permissions: []string{PermissionManageAPIKeys}},
+		{Method: "GET", Path: "/user/api-keys", AnyAuthenticated: true},
+		{Method: "POST", Path: "/user/profile", AnyAuthenticated: true},
+	}}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		want   *PolicyRule
+	}{
+		{"exact method wins over wildcard", "GET", "/user/api-keys", &p.Rules[1]},
+		{"wildcard method", "DELETE", "/user/api-keys", &p.Rules[0]},
+		{"exact method only", "POST", "/user/profile", &p.Rules[2]},
+		{"other method", "GET", "/user/profile", nil},
+		{"unknown path", "GET", "/user/unknown", nil},
+		{"path must match exactly", "GET", "/user/api-keys/{id}", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := p.Rule(tt.method, tt.path); got != tt.want {
+				t.Errorf("Rule(%s, %s) = %+v, want %+v", tt.method, tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolicyRuleAllows(t *testing.T) {
+	user := &Claims{UserRoles: NewUserRoles(RoleUser)}
+	organizer := &Claims{UserRoles: NewUserRoles(RoleOrganizer)}
+	admin := &Claims{UserRoles: NewUserRoles(RoleAdmin)}
+	orgAdmin := &Claims{UserRoles: NewUserRoles(RoleUser), Org: "o1", OrgRoles: []string{RoleAdmin}}
+	orgUser := &Claims{UserRoles: NewUserRoles(RoleAdmin), Org: "o1", OrgRoles: []string{RoleUser}}
+
+	tests := []struct {
+		name   string
+		rule   PolicyRule
+		claims *Claims
+		want   bool
+	}{
+		{"any authenticated", PolicyRule{AnyAuthenticated: true}, user, true},
+		{"one of the roles", PolicyRule{Roles: []string{RoleModerator, RoleOrganizer}}, organizer, true},
+		{"none of the roles", PolicyRule{Roles: []string{RoleModerator, RoleOrganizer}}, user, false},
+		{"inherited role", PolicyRule{Roles: []string{RoleModerator}}, admin, true},
+		{"permission", PolicyRule{Permissions: []string{PermissionManageAPIKeys}}, organizer, true},
+		{"all permissions needed", PolicyRule{Permissions: []string{PermissionManageAPIKeys, PermissionManageUsers}}, organizer, false},
+		{"role and permission", PolicyRule{Roles: []string{RoleUser}, Permissions: []string{PermissionManageUsers}}, user, false},
+		{"org rule uses org roles", PolicyRule{Org: true, Permissions: []string{PermissionManageUsers}}, orgAdmin, true},
+		{"org rule ignores global roles", PolicyRule{Org: true, Permissions: []string{PermissionManageUsers}}, orgUser, false},
+		{"org rule needs an active org", PolicyRule{Org: true, AnyAuthenticated: true}, admin, false},
+		{"global rule ignores org roles", PolicyRule{Permissions: []string{PermissionManageUsers}}, orgAdmin, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.rule.Allows(tt.claims); got != tt.want {
+				t.Errorf("Allows() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPolicyValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   []PolicyRule
+		attrs   []AttributeRule
+		wantErr bool
+	}{
+		{"valid", []PolicyRule{
+			{Method: "*", Path: "/user/api-keys", Permissions: []string{PermissionManageAPIKeys}},
+			{Method: "GET", Path: "/user/api-keys", Roles: []string{RoleOrganizer}},
+		}, nil, false},
+		{"unsupported method", []PolicyRule{{Method: "TRACE", Path: "/user", AnyAuthenticated: true}}, nil, true},
+		{"relative path", []PolicyRule{{Method: "GET", Path: "user", AnyAuthenticated: true}}, nil, true},
+		{"duplicate rule", []PolicyRule{
+			{Method: "GET", Path: "/user", AnyAuthenticated: true},
+			{Method: "GET", Path: "/user", Roles: []string{RoleAdmin}},
+		}, nil, true},
+		{"open without any_authenticated", []PolicyRule{{Method: "GET", Path: "/user"}}, nil, true},
+		{"unknown role", []PolicyRule{{Method: "GET", Path: "/user", Roles: []string{"superuser"}}}, nil, true},
+		{"unknown permission", []PolicyRule{{Method: "GET", Path: "/user", Permissions: []string{"everything"}}}, nil, true},
+		{"invalid attribute rule", nil, []AttributeRule{{ID: "r", Actions: []string{"a"}, Effect: "maybe"}}, true},
+		{"duplicate attribute rule", nil, []AttributeRule{
+			{ID: "r", Actions: []string{"a"}, Effect: EffectAllow},
+			{ID: "r", Actions: []string{"b"}, Effect: EffectDeny},
+		}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Policy{Rules: tt.rules, Attributes: tt.attrs}
+			if err := p.validate(); (err != nil) != tt.wantErr {
+				t.Errorf("validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestShippedPolicyIsValid(t *testing.T) {
+	if _, err := loadPolicy("../policy.json", nil); err != nil {
+		t.Fatalf("policy.json: %v", err)
+	}
+}
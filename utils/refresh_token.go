@@ -0,0 +1,170 @@
+package utils
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"firebase.google.com/go/db"
+)
+
+// RefreshTokenTTL is how long an unused refresh token stays valid
+const RefreshTokenTTL = 30 * 24 * time.Hour
+
+var (
+	ErrRefreshTokenInvalid = errors.New("invalid or expired refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reuse detected")
+)
+
+// RefreshToken is the record stored under users/{uid}/refresh_tokens/{hash}.
+// Only the SHA-256 hash of the token is ever persisted.
+type RefreshToken struct {
+	Family    string `json:"family"`
+	CreatedAt int64  `json:"created_at"`
+	ExpiresAt int64  `json:"expires_at"`
+	UsedAt    int64  `json:"used_at,omitempty"`
+}
+
+// randomToken returns n random bytes encoded as URL-safe base64
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func refreshTokensRef(uid string) *db.Ref {
+	return FirebaseDB.NewRef("users/" + uid + "/refresh_tokens")
+}
+
+// IssueRefreshToken creates a new opaque refresh token for the user. The
+// family is the id of the session the token belongs to; rotations keep the
+// family of the token they replace.
+func IssueRefreshToken(uid, family string) (string, error) {
+	secret, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+	// The UID prefix lets us find the user's node without a global index
+	token := uid + "." + secret
+
+	now := time.Now()
+	record := RefreshToken{
+		Family:    family,
+		CreatedAt: now.Unix(),
+		ExpiresAt: now.Add(RefreshTokenTTL).Unix(),
+	}
+	if err := refreshTokensRef(uid).Child(hashToken(token)).Set(context.Background(), record); err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// RotateRefreshToken consumes a refresh token and returns the UID and session
+// it belongs to together with a replacement token from the same family.
+// Presenting a token that was already used ends its whole session.
+func RotateRefreshToken(token string) (uid, family, newToken string, err error) {
+	uid, _, ok := strings.Cut(token, ".")
+	if !ok || uid == "" {
+		return "", "", "", ErrRefreshTokenInvalid
+	}
+
+	var record RefreshToken
+	ref := refreshTokensRef(uid).Child(hashToken(token))
+	err = ref.Transaction(context.Background(), func(node db.TransactionNode) (interface{}, error) {
+		record = RefreshToken{}
+		if err := node.Unmarshal(&record); err != nil {
+			return nil, ErrRefreshTokenInvalid
+		}
+		if err := consumeRefreshToken(&record, time.Now().Unix()); err != nil {
+			return nil, err
+		}
+		return record, nil
+	})
+	if errors.Is(err, ErrRefreshTokenReused) {
+		log.Printf("Refresh token reuse detected for user %s, ending session %s", uid, record.Family)
+		if endErr := EndSession(uid, record.Family); endErr != nil {
+			return "", "", "", endErr
+		}
+		return "", "", "", err
+	}
+	if err != nil {
+		return "", "", "", err
+	}
+
+	newToken, err = IssueRefreshToken(uid, record.Family)
+	if err != nil {
+		return "", "", "", err
+	}
+	return uid, record.Family, newToken, nil
+}
+
+// consumeRefreshToken marks the stored record as used at now. A token that
+// was used before is a replayed one, reported as ErrRefreshTokenReused even
+// once it has expired; unknown and expired tokens are ErrRefreshTokenInvalid.
+func consumeRefreshToken(record *RefreshToken, now int64) error {
+	if record.Family == "" {
+		return ErrRefreshTokenInvalid
+	}
+	if record.UsedAt != 0 {
+		return ErrRefreshTokenReused
+	}
+	if now >= record.ExpiresAt {
+		return ErrRefreshTokenInvalid
+	}
+	record.UsedAt = now
+	return nil
+}
+
+// RevokeRefreshToken revokes the family of the given refresh token, so neither
+// it nor any token rotated from it can be used again
+func RevokeRefreshToken(token string) error {
+	uid, _, ok := strings.Cut(token, ".")
+	if !ok || uid == "" {
+		return ErrRefreshTokenInvalid
+	}
+
+	var record RefreshToken
+	if err := refreshTokensRef(uid).Child(hashToken(token)).Get(context.Background(), &record); err != nil {
+		return err
+	}
+	if record.Family == "" {
+		// Unknown or already revoked, nothing left to do
+		return nil
+	}
+	return RevokeRefreshFamily(uid, record.Family)
+}
+
+// RevokeRefreshFamily deletes every refresh token of the given family, along
+// with any of the user's tokens that have already expired
+func RevokeRefreshFamily(uid, family string) error {
+	var tokens map[string]RefreshToken
+	if err := refreshTokensRef(uid).Get(context.Background(), &tokens); err != nil {
+		return err
+	}
+
+	now := time.Now().Unix()
+	updates := make(map[string]interface{})
+	for hash, t := range tokens {
+		if t.Family == family || now >= t.ExpiresAt {
+			updates[hash] = nil
+		}
+	}
+	if len(updates) == 0 {
+		return nil
+	}
+	return refreshTokensRef(uid).Update(context.Background(), updates)
+}
@@ -0,0 +1,56 @@
+package utils
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestConsumeRefreshToken(t *testing.T) {
+	const now = 1700000000
+
+	tests := []struct {
+		name    string
+		record  RefreshToken
+		wantErr error
+	}{
+		{"fresh token", RefreshToken{Family: "s1", CreatedAt: now - 60, ExpiresAt: now + 60}, nil},
+		{"unknown token", RefreshToken{}, ErrRefreshTokenInvalid},
+		{"expired token", RefreshToken{Family: "s1", ExpiresAt: now}, ErrRefreshTokenInvalid},
+		{"reused token", RefreshToken{Family: "s1", ExpiresAt: now + 60, UsedAt: now - 30}, ErrRefreshTokenReused},
+		{"reused after expiry", RefreshToken{Family: "s1", ExpiresAt: now - 60, UsedAt: now - 120}, ErrRefreshTokenReused},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			record := tt.record
+			err := consumeRefreshToken(&record, now)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("consumeRefreshToken() error = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && record.UsedAt != now {
+				t.Errorf("UsedAt = %d, want %d", record.UsedAt, now)
+			}
+			if err != nil && record.UsedAt != tt.record.UsedAt {
+				t.Errorf("a rejected token was marked as used")
+			}
+		})
+	}
+}
+
+func TestConsumeRefreshTokenTwice(t *testing.T) {
+	record := RefreshToken{Family: "s1", ExpiresAt: 200}
+	if err := consumeRefreshToken(&record, 100); err != nil {
+		t.Fatalf("first use: %v", err)
+	}
+	if err := consumeRefreshToken(&record, 101); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Errorf("second use: error = %v, want %v", err, ErrRefreshTokenReused)
+	}
+}
+
+func TestRotateRefreshTokenMalformed(t *testing.T) {
+	for _, token := range []string{"", "no-separator", ".secret"} {
+		if _, _, _, err := RotateRefreshToken(token); !errors.Is(err, ErrRefreshTokenInvalid) {
+			t.Errorf("RotateRefreshToken(%q) error = %v, want %v", token, err, ErrRefreshTokenInvalid)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// revocationCacheTTL bounds how long a "not revoked" answer is trusted before
+// the database is asked again. Revocations made by this instance are cached
+// right away and take effect immediately.
+const revocationCacheTTL = 15 * time.Second
+
+var ErrTokenRevoked = errors.New("token has been revoked")
+
+// RevokedToken is the denylist record stored under revoked_tokens/{jti}. It is
+// only needed until the token would have expired anyway.
+type RevokedToken struct {
+	UID       string `json:"uid"`
+	ExpiresAt int64  `json:"expires_at"`
+}
+
+type revocationEntry struct {
+	revoked bool
+	until   time.Time
+}
+
+var (
+	revocationMu sync.Mutex
+	revokedJTIs  = make(map[string]revocationEntry)
+)
+
+// RevokeToken puts a single token on the denylist until it expires
+func RevokeToken(claims *Claims) error {
+	record := RevokedToken{UID: claims.UID, ExpiresAt: claims.ExpiresAt}
+	if err := FirebaseDB.NewRef("revoked_tokens/"+claims.Id).Set(context.Background(), record); err != nil {
+		return err
+	}
+
+	revocationMu.Lock()
+	revokedJTIs[claims.Id] = revocationEntry{revoked: true, until: time.Unix(claims.ExpiresAt, 0)}
+	revocationMu.Unlock()
+	return nil
+}
+
+// RevokeAllTokens invalidates every token issued to the user so far, along
+// with all of the user's sessions and refresh tokens
+func RevokeAllTokens(uid string) error {
+	if err := BumpTokenVersion(uid); err != nil {
+		return err
+	}
+	if err := refreshTokensRef(uid).Delete(context.Background()); err != nil {
+		return err
+	}
+	if err := EndAllSessions(uid); err != nil {
+		return err
+	}
+	// Sign out Firebase client SDK sessions too
+	if err := FirebaseAuth.RevokeRefreshTokens(context.Background(), uid); err != nil {
+		return err
+	}
+	return nil
+}
+
+// CheckTokenRevoked returns ErrTokenRevoked if the token is on the denylist,
+// was issued before the user's token version was last bumped (by a logout
+// from all devices or a change to the account) or is for an org whose
+// membership has changed since
+func CheckTokenRevoked(claims *Claims) error {
+	revoked, err := isJTIRevoked(claims.Id)
+	if err != nil {
+		return err
+	}
+	if revoked {
+		return ErrTokenRevoked
+	}
+	// Service principals have no user record to carry a token version
+	if claims.IsService() {
+		return nil
+	}
+	if err := CheckTokenVersion(claims); err != nil {
+		return err
+	}
+	return CheckOrgMembership(claims)
+}
+
+func isJTIRevoked(jti string) (bool, error) {
+	if jti == "" {
+		// Tokens without a jti predate revocation support
+		return true, nil
+	}
+
+	now := time.Now()
+	revocationMu.Lock()
+	entry, ok := revokedJTIs[jti]
+	revocationMu.Unlock()
+	if ok && now.Before(entry.until) {
+		return entry.revoked, nil
+	}
+
+	var record RevokedToken
+	if err := FirebaseDB.NewRef("revoked_tokens/"+jti).Get(context.Background(), &record); err != nil {
+		return false, err
+	}
+	entry = revocationEntry{until: now.Add(revocationCacheTTL)}
+	if record.ExpiresAt != 0 {
+		entry = revocationEntry{revoked: true, until: time.Unix(record.ExpiresAt, 0)}
+	}
+
+	revocationMu.Lock()
+	revokedJTIs[jti] = entry
+	revocationMu.Unlock()
+	return entry.revoked, nil
+}
+
+// PruneRevokedTokens removes denylist records of tokens that have expired, both
+// from the database and from the in-memory cache. It relies on an
+// ".indexOn": "expires_at" rule for revoked_tokens.
+func PruneRevokedTokens() error {
+	now := time.Now()
+	var expired map[string]RevokedToken
+	err := FirebaseDB.NewRef("revoked_tokens").OrderByChild("expires_at").EndAt(now.Unix()).Get(context.Background(), &expired)
+	if err != nil {
+		return err
+	}
+
+	if len(expired) > 0 {
+		updates := make(map[string]interface{}, len(expired))
+		for jti := range expired {
+			updates[jti] = nil
+		}
+		if err := FirebaseDB.NewRef("revoked_tokens").Update(context.Background(), updates); err != nil {
+			return err
+		}
+	}
+
+	revocationMu.Lock()
+	for jti, entry := range revokedJTIs {
+		if !now.Before(entry.until) {
+			delete(revokedJTIs, jti)
+		}
+	}
+	revocationMu.Unlock()
+	return nil
+}
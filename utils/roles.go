@@ -0,0 +1,326 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+)
+
+// Roles a user can hold. Further roles can be defined in the role registry;
+// these are the ones the code itself relies on.
+const (
+	RoleUser      = "user"
+	RoleOrganizer = "organizer"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+	// RolePendingOrganizer is held by users who registered as organizers
+	// until an admin reviews the request; it grants what RoleUser grants
+	RolePendingOrganizer = "pending_organizer"
+)
+
+// Permissions checked by RequirePermission and the handlers
+const (
+	PermissionViewProfile      = "profile:view"
+	PermissionEditProfile      = "profile:edit"
+	PermissionManageAPIKeys    = "api_keys:manage"
+	PermissionInviteUsers      = "users:invite"
+	PermissionModerateContent  = "content:moderate"
+	PermissionManageUsers      = "users:manage"
+	PermissionReviewOrganizers = "organizers:review"
+	PermissionImpersonate      = "users:impersonate"
+	PermissionExplainPolicy    = "policies:explain"
+)
+
+// RoleDefinition is an entry of the role registry
+type RoleDefinition struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"display_name"`
+	// Permissions are granted to the role directly; a role also has the
+	// permissions of every role it inherits
+	Permissions []string `json:"permissions,omitempty"`
+	// Inherits lists the roles this role includes, e.g. admin ⊃ moderator
+	Inherits []string `json:"inherits,omitempty"`
+	// SelfAssignable roles may be picked at signup; all others can only be
+	// given by an admin
+	SelfAssignable bool `json:"self_assignable"`
+}
+
+// RoleRegistry is the format of the file referenced by AUTH_ROLES_FILE
+type RoleRegistry struct {
+	Roles []RoleDefinition `json:"roles"`
+}
+
+// defaultRoleRegistry is used when AUTH_ROLES_FILE is not set
+var defaultRoleRegistry = RoleRegistry{Roles: []RoleDefinition{
+	{
+		Name:           RoleUser,
+		DisplayName:    "User",
+		Permissions:    []string{PermissionViewProfile, PermissionEditProfile},
+		SelfAssignable: true,
+	},
+	{
+		Name:        RoleOrganizer,
+		DisplayName: "Organizer",
+		Permissions: []string{PermissionManageAPIKeys, PermissionInviteUsers},
+		Inherits:    []string{RoleUser},
+		// Registering as an organizer only requests the role
+		SelfAssignable: true,
+	},
+	{
+		Name:        RolePendingOrganizer,
+		DisplayName: "Organizer (pending approval)",
+		Inherits:    []string{RoleUser},
+	},
+	{
+		Name:        RoleModerator,
+		DisplayName: "Moderator",
+		Permissions: []string{PermissionModerateContent},
+		Inherits:    []string{RoleUser},
+	},
+	{
+		Name:        RoleAdmin,
+		DisplayName: "Administrator",
+		Permissions: []string{PermissionManageUsers, PermissionReviewOrganizers, PermissionImpersonate, PermissionExplainPolicy},
+		Inherits:    []string{RoleModerator, RoleOrganizer},
+	},
+}}
+
+// roles indexes the registry in effect by role name
+var roles map[string]*RoleDefinition
+
+func init() {
+	if err := setRoleRegistry(&defaultRoleRegistry); err != nil {
+		panic(err)
+	}
+}
+
+// InitRoles loads the role registry from AUTH_ROLES_FILE, if set
+func InitRoles() {
+	path := os.Getenv("AUTH_ROLES_FILE")
+	if path == "" {
+		return
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		log.Fatalf("Error loading role registry: %v\n", err)
+	}
+	var registry RoleRegistry
+	if err := json.Unmarshal(data, &registry); err != nil {
+		log.Fatalf("Error loading role registry: %v\n", err)
+	}
+	if err := setRoleRegistry(&registry); err != nil {
+		log.Fatalf("Invalid role registry: %v\n", err)
+	}
+}
+
+// setRoleRegistry validates the registry and puts it in effect. Every role
+// needs a name and a display name, the roles the code relies on must be
+// defined, and inheritance may only name defined roles and must not loop.
+func setRoleRegistry(registry *RoleRegistry) error {
+	index := make(map[string]*RoleDefinition, len(registry.Roles))
+	for i := range registry.Roles {
+		role := &registry.Roles[i]
+		if role.Name == "" || role.DisplayName == "" {
+			return fmt.Errorf("role %d needs a name and a display name", i)
+		}
+		if _, dup := index[role.Name]; dup {
+			return fmt.Errorf("duplicate role %q", role.Name)
+		}
+		index[role.Name] = role
+	}
+	for _, name := range []string{RoleUser, RoleOrganizer, RolePendingOrganizer, RoleAdmin} {
+		if _, ok := index[name]; !ok {
+			return fmt.Errorf("role %q must be defined", name)
+		}
+	}
+	for _, role := range index {
+		for _, inherited := range role.Inherits {
+			if _, ok := index[inherited]; !ok {
+				return fmt.Errorf("role %q inherits unknown role %q", role.Name, inherited)
+			}
+		}
+	}
+
+	// Depth-first search; a role reached again while still on the stack
+	// closes a cycle
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := make(map[string]int)
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case visiting:
+			return fmt.Errorf("role %q inherits itself", name)
+		case done:
+			return nil
+		}
+		state[name] = visiting
+		for _, inherited := range index[name].Inherits {
+			if err := visit(inherited); err != nil {
+				return err
+			}
+		}
+		state[name] = done
+		return nil
+	}
+	for name := range index {
+		if err := visit(name); err != nil {
+			return err
+		}
+	}
+
+	roles = index
+	return nil
+}
+
+// GetRole returns the definition of the role, or nil if it is not defined
+func GetRole(name string) *RoleDefinition {
+	return roles[name]
+}
+
+// IsKnownRole reports whether the role is defined in the registry
+func IsKnownRole(name string) bool {
+	return roles[name] != nil
+}
+
+// ListRoles returns the definitions of all roles, sorted by name
+func ListRoles() []RoleDefinition {
+	list := make([]RoleDefinition, 0, len(roles))
+	for _, role := range roles {
+		list = append(list, *role)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// IsKnownPermission reports whether any role grants the permission
+func IsKnownPermission(permission string) bool {
+	for _, role := range roles {
+		for _, p := range role.Permissions {
+			if p == permission {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ValidateRoles checks a set of roles to be assigned to a user: it must not
+// be empty, hold duplicates or undefined roles, and at signup only
+// self-assignable roles may be picked
+func ValidateRoles(names []string, signup bool) error {
+	if len(names) == 0 {
+		return fmt.Errorf("at least one role is required")
+	}
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		role := GetRole(name)
+		if role == nil {
+			return fmt.Errorf("unknown role: %s", name)
+		}
+		if signup && !role.SelfAssignable {
+			return fmt.Errorf("role cannot be chosen at signup: %s", name)
+		}
+		if seen[name] {
+			return fmt.Errorf("duplicate role: %s", name)
+		}
+		seen[name] = true
+	}
+	return nil
+}
+
+// ExpandRoles returns the roles together with every role they inherit
+func ExpandRoles(names []string) []string {
+	var expanded []string
+	seen := make(map[string]bool)
+	var add func(name string)
+	add = func(name string) {
+		if seen[name] {
+			return
+		}
+		seen[name] = true
+		expanded = append(expanded, name)
+		if role := roles[name]; role != nil {
+			for _, inherited := range role.Inherits {
+				add(inherited)
+			}
+		}
+	}
+	for _, name := range names {
+		add(name)
+	}
+	return expanded
+}
+
+// UserRoles is how roles are stored under users/{uid} and carried in Claims.
+// Roles holds every role of the user and Role the primary one, the first of
+// Roles. Records and tokens from before users could hold several roles only
+// have Role.
+type UserRoles struct {
+	Role  string   `json:"role"`
+	Roles []string `json:"roles,omitempty"`
+}
+
+// NewUserRoles returns the UserRoles for the roles, the first being primary
+func NewUserRoles(roles ...string) UserRoles {
+	if len(roles) == 0 {
+		return UserRoles{}
+	}
+	return UserRoles{Role: roles[0], Roles: roles}
+}
+
+// List returns the roles the user was assigned
+func (r UserRoles) List() []string {
+	if len(r.Roles) > 0 {
+		return r.Roles
+	}
+	if r.Role != "" {
+		return []string{r.Role}
+	}
+	return nil
+}
+
+// HasRole reports whether the user holds one of the roles, directly or
+// through the role hierarchy
+func (r UserRoles) HasRole(roles ...string) bool {
+	for _, held := range ExpandRoles(r.List()) {
+		for _, role := range roles {
+			if held == role {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// HasPermission reports whether one of the user's roles grants the permission
+func (r UserRoles) HasPermission(permission string) bool {
+	for _, name := range ExpandRoles(r.List()) {
+		role := GetRole(name)
+		if role == nil {
+			continue
+		}
+		for _, p := range role.Permissions {
+			if p == permission {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// GetUserRoles reads the roles stored for the user. The key range query
+// fetches role and roles in one request without the rest of the user node.
+func GetUserRoles(uid string) (UserRoles, error) {
+	var roles UserRoles
+	err := FirebaseDB.NewRef("users/"+uid).OrderByKey().StartAt("role").EndAt("roles").Get(context.Background(), &roles)
+	if err != nil {
+		return roles, err
+	}
+	return roles, nil
+}
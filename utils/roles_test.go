@@ -0,0 +1,145 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestValidateRoles(t *testing.T) {
+	tests := []struct {
+		name    string
+		roles   []string
+		signup  bool
+		wantErr bool
+	}{
+		{"single role", []string{RoleUser}, false, false},
+		{"several roles", []string{RoleOrganizer, RoleModerator}, false, false},
+		{"self-assignable at signup", []string{RoleOrganizer}, true, false},
+		{"admin-only role at signup", []string{RoleModerator}, true, true},
+		{"admin at signup", []string{RoleUser, RoleAdmin}, true, true},
+		{"pending_organizer at signup", []string{RolePendingOrganizer}, true, true},
+		{"admin-only role by an admin", []string{RoleAdmin}, false, false},
+		{"empty", nil, false, true},
+		{"unknown role", []string{"superuser"}, false, true},
+		{"duplicate role", []string{RoleUser, RoleUser}, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateRoles(tt.roles, tt.signup)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateRoles(%v, %v) error = %v, wantErr %v", tt.roles, tt.signup, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestExpandRoles(t *testing.T) {
+	tests := []struct {
+		name  string
+		roles []string
+		want  []string
+	}{
+		{"no roles", nil, nil},
+		{"no inheritance", []string{RoleUser}, []string{RoleUser}},
+		{"inherits user", []string{RoleOrganizer}, []string{RoleOrganizer, RoleUser}},
+		{"transitive", []string{RoleAdmin}, []string{RoleAdmin, RoleModerator, RoleUser, RoleOrganizer}},
+		{"shared ancestor once", []string{RoleModerator, RoleOrganizer}, []string{RoleModerator, RoleUser, RoleOrganizer}},
+		{"unknown role kept", []string{"superuser"}, []string{"superuser"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ExpandRoles(tt.roles); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ExpandRoles(%v) = %v, want %v", tt.roles, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUserRolesPermissions(t *testing.T) {
+	tests := []struct {
+		name       string
+		roles      UserRoles
+		permission string
+		want       bool
+	}{
+		{"direct", NewUserRoles(RoleUser), PermissionViewProfile, true},
+		{"inherited", NewUserRoles(RoleAdmin), PermissionManageAPIKeys, true},
+		{"not granted", NewUserRoles(RoleOrganizer), PermissionManageUsers, false},
+		{"from a second role", NewUserRoles(RoleUser, RoleModerator), PermissionModerateContent, true},
+		{"legacy single role", UserRoles{Role: RoleOrganizer}, PermissionInviteUsers, true},
+		{"pending organizer is a user", NewUserRoles(RolePendingOrganizer), PermissionManageAPIKeys, false},
+		{"no roles", UserRoles{}, PermissionViewProfile, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.roles.HasPermission(tt.permission); got != tt.want {
+				t.Errorf("HasPermission(%s) = %v, want %v", tt.permission, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSetRoleRegistry(t *testing.T) {
+	t.Cleanup(func() {
+		if err := setRoleRegistry(&defaultRoleRegistry); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	// required returns the roles the code relies on, with extra appended
+	required := func(extra ...RoleDefinition) []RoleDefinition {
+		return append([]RoleDefinition{
+			{Name: RoleUser, DisplayName: "User"},
+			{Name: RoleOrganizer, DisplayName: "Organizer", Inherits: []string{RoleUser}},
+			{Name: RolePendingOrganizer, DisplayName: "Pending"},
+			{Name: RoleAdmin, DisplayName: "Admin"},
+		}, extra...)
+	}
+
+	tests := []struct {
+		name    string
+		roles   []RoleDefinition
+		wantErr bool
+	}{
+		{"default", defaultRoleRegistry.Roles, false},
+		{"custom role", required(RoleDefinition{Name: "speaker", DisplayName: "Speaker", Inherits: []string{RoleUser}}), false},
+		{"missing name", required(RoleDefinition{DisplayName: "Nameless"}), true},
+		{"missing display name", required(RoleDefinition{Name: "speaker"}), true},
+		{"duplicate role", required(RoleDefinition{Name: RoleUser, DisplayName: "User again"}), true},
+		{"required role missing", required()[1:], true},
+		{"unknown inherited role", required(RoleDefinition{Name: "speaker", DisplayName: "Speaker", Inherits: []string{"guest"}}), true},
+		{"inherits itself", required(RoleDefinition{Name: "speaker", DisplayName: "Speaker", Inherits: []string{"speaker"}}), true},
+		{"cycle", required(
+			RoleDefinition{Name: "a", DisplayName: "A", Inherits: []string{"b"}},
+			RoleDefinition{Name: "b", DisplayName: "B", Inherits: []string{"c"}},
+			RoleDefinition{Name: "c", DisplayName: "C", Inherits: []string{"a"}},
+		), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := setRoleRegistry(&RoleRegistry{Roles: tt.roles})
+			if (err != nil) != tt.wantErr {
+				t.Errorf("setRoleRegistry() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSetRoleRegistryKeepsPreviousOnError(t *testing.T) {
+	t.Cleanup(func() {
+		if err := setRoleRegistry(&defaultRoleRegistry); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	if err := setRoleRegistry(&RoleRegistry{Roles: []RoleDefinition{{Name: RoleUser, DisplayName: "User"}}}); err == nil {
+		t.Fatal("setRoleRegistry() accepted a registry without the required roles")
+	}
+	if !IsKnownRole(RoleModerator) {
+		t.Error("a rejected registry replaced the one in effect")
+	}
+}
@@ -0,0 +1,55 @@
+package utils
+
+import "strings"
+
+// Scopes that limit what a token or API key can be used for
+const (
+	ScopeProfileRead  = "profile:read"
+	ScopeProfileWrite = "profile:write"
+	// ScopeAccount covers managing the account itself: password, sessions and API keys
+	ScopeAccount = "account"
+	// ScopeAdmin covers the /admin routes; what a token may do there is still
+	// up to the caller's roles
+	ScopeAdmin = "admin"
+)
+
+// KnownScopes lists every scope a client may ask for. Tokens issued at login
+// carry all of them.
+var KnownScopes = []string{
+	ScopeProfileRead,
+	ScopeProfileWrite,
+	ScopeAccount,
+	ScopeAdmin,
+}
+
+// DefaultScope is the scope claim of a full login token
+func DefaultScope() string {
+	return strings.Join(KnownScopes, " ")
+}
+
+// IsKnownScope reports whether scope is one of KnownScopes
+func IsKnownScope(scope string) bool {
+	for _, s := range KnownScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// IsDelegableScope reports whether the scope may be handed to API keys, OAuth
+// clients and impersonation tokens. Managing the account and the /admin
+// routes are kept to the user's own login tokens.
+func IsDelegableScope(scope string) bool {
+	return IsKnownScope(scope) && scope != ScopeAccount && scope != ScopeAdmin
+}
+
+// HasScope reports whether the claims were granted the scope
+func (c *Claims) HasScope(scope string) bool {
+	for _, s := range strings.Fields(c.Scope) {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
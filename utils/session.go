@@ -0,0 +1,194 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// lastSeenInterval throttles how often a session's last_seen is written back
+const lastSeenInterval = time.Minute
+
+var ErrSessionEnded = errors.New("session has ended")
+
+// Session is a logged in device, stored under users/{uid}/sessions/{id}. The
+// session id doubles as the family of the refresh tokens issued to it.
+type Session struct {
+	ID        string `json:"id"`
+	UserAgent string `json:"user_agent"`
+	IP        string `json:"ip"`
+	CreatedAt int64  `json:"created_at"`
+	LastSeen  int64  `json:"last_seen"`
+	// Org is the organization active in the session, carried over on refresh
+	Org string `json:"org,omitempty"`
+}
+
+type sessionEntry struct {
+	active   bool
+	lastSeen int64
+	until    time.Time
+}
+
+var (
+	sessionMu    sync.Mutex
+	sessionCache = make(map[string]sessionEntry)
+)
+
+func sessionPath(uid, sid string) string {
+	return "users/" + uid + "/sessions/" + sid
+}
+
+// CreateSession records a new login of the user, with org active if it is not
+// empty, and returns its id
+func CreateSession(uid, userAgent, ip, org string) (string, error) {
+	sid, err := randomToken(16)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now().Unix()
+	session := Session{
+		ID:        sid,
+		UserAgent: userAgent,
+		IP:        ip,
+		CreatedAt: now,
+		LastSeen:  now,
+		Org:       org,
+	}
+	if err := FirebaseDB.NewRef(sessionPath(uid, sid)).Set(context.Background(), session); err != nil {
+		return "", err
+	}
+	return sid, nil
+}
+
+// ListSessions returns the user's sessions, most recently used first
+func ListSessions(uid string) ([]Session, error) {
+	var sessions map[string]Session
+	if err := FirebaseDB.NewRef("users/"+uid+"/sessions").Get(context.Background(), &sessions); err != nil {
+		return nil, err
+	}
+
+	list := make([]Session, 0, len(sessions))
+	for _, s := range sessions {
+		if s.ID != "" {
+			list = append(list, s)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].LastSeen > list[j].LastSeen })
+	return list, nil
+}
+
+// GetSession returns the session, or nil if it does not exist
+func GetSession(uid, sid string) (*Session, error) {
+	var session Session
+	if err := FirebaseDB.NewRef(sessionPath(uid, sid)).Get(context.Background(), &session); err != nil {
+		return nil, err
+	}
+	if session.ID == "" {
+		return nil, nil
+	}
+	return &session, nil
+}
+
+// SetSessionOrg changes the organization active in the session
+func SetSessionOrg(uid, sid, org string) error {
+	var value interface{}
+	if org != "" {
+		value = org
+	}
+	return FirebaseDB.NewRef("").Update(context.Background(), map[string]interface{}{
+		sessionPath(uid, sid) + "/org": value,
+	})
+}
+
+// EndSession deletes the session together with its refresh tokens. Access
+// tokens bound to it are rejected from then on.
+func EndSession(uid, sid string) error {
+	if err := FirebaseDB.NewRef(sessionPath(uid, sid)).Delete(context.Background()); err != nil {
+		return err
+	}
+
+	sessionMu.Lock()
+	sessionCache[uid+"/"+sid] = sessionEntry{active: false, until: time.Now().Add(AccessTokenTTL)}
+	sessionMu.Unlock()
+
+	return RevokeRefreshFamily(uid, sid)
+}
+
+// EndAllSessions deletes every session of the user
+func EndAllSessions(uid string) error {
+	if err := FirebaseDB.NewRef("users/" + uid + "/sessions").Delete(context.Background()); err != nil {
+		return err
+	}
+
+	sessionMu.Lock()
+	for key := range sessionCache {
+		if strings.HasPrefix(key, uid+"/") {
+			delete(sessionCache, key)
+		}
+	}
+	sessionMu.Unlock()
+	return nil
+}
+
+// CheckSession returns ErrSessionEnded if the token belongs to a session that
+// has been killed, and keeps the session's last_seen up to date. Tokens that
+// are not bound to a session pass.
+func CheckSession(claims *Claims) error {
+	if claims.SID == "" {
+		return nil
+	}
+	return TouchSession(claims.UID, claims.SID)
+}
+
+// TouchSession is CheckSession for callers that only know the ids
+func TouchSession(uid, sid string) error {
+	return checkSession(uid, sid, true)
+}
+
+// checkSession returns ErrSessionEnded if the session has been killed. With
+// touch set, it also updates the session's last_seen.
+func checkSession(uid, sid string, touch bool) error {
+	key := uid + "/" + sid
+	now := time.Now()
+
+	sessionMu.Lock()
+	entry, ok := sessionCache[key]
+	sessionMu.Unlock()
+
+	if !ok || !now.Before(entry.until) {
+		session, err := GetSession(uid, sid)
+		if err != nil {
+			return err
+		}
+		entry = sessionEntry{active: session != nil, until: now.Add(revocationCacheTTL)}
+		if session != nil {
+			entry.lastSeen = session.LastSeen
+		}
+	}
+
+	if !entry.active {
+		sessionMu.Lock()
+		sessionCache[key] = entry
+		sessionMu.Unlock()
+		return ErrSessionEnded
+	}
+
+	if touch && now.Unix()-entry.lastSeen >= int64(lastSeenInterval.Seconds()) {
+		entry.lastSeen = now.Unix()
+		if err := FirebaseDB.NewRef(sessionPath(uid, sid)).Update(context.Background(), map[string]interface{}{
+			"last_seen": entry.lastSeen,
+		}); err != nil {
+			log.Printf("Failed to update session last_seen: %v", err)
+		}
+	}
+
+	sessionMu.Lock()
+	sessionCache[key] = entry
+	sessionMu.Unlock()
+	return nil
+}
@@ -0,0 +1,84 @@
+package utils
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"firebase.google.com/go/db"
+)
+
+// tokenVersionCacheTTL bounds how long another instance may keep accepting
+// tokens after a user's token version was bumped
+const tokenVersionCacheTTL = 30 * time.Second
+
+type tokenVersionEntry struct {
+	version int64
+	until   time.Time
+}
+
+var (
+	tokenVersionMu    sync.Mutex
+	tokenVersionCache = make(map[string]tokenVersionEntry)
+)
+
+func tokenVersionRef(uid string) *db.Ref {
+	return FirebaseDB.NewRef("users/" + uid + "/token_version")
+}
+
+// GetTokenVersion reads the user's current token version from the database.
+// Use it when issuing tokens; checks go through the cache instead.
+func GetTokenVersion(uid string) (int64, error) {
+	var version int64
+	if err := tokenVersionRef(uid).Get(context.Background(), &version); err != nil {
+		return 0, err
+	}
+	cacheTokenVersion(uid, version)
+	return version, nil
+}
+
+// BumpTokenVersion increments the user's token version, which invalidates
+// every token issued before the call
+func BumpTokenVersion(uid string) error {
+	var version int64
+	err := tokenVersionRef(uid).Transaction(context.Background(), func(node db.TransactionNode) (interface{}, error) {
+		version = 0
+		if err := node.Unmarshal(&version); err != nil {
+			return nil, err
+		}
+		version++
+		return version, nil
+	})
+	if err != nil {
+		return err
+	}
+	cacheTokenVersion(uid, version)
+	return nil
+}
+
+// CheckTokenVersion returns ErrTokenRevoked if the token was issued before the
+// user's token version was last bumped
+func CheckTokenVersion(claims *Claims) error {
+	tokenVersionMu.Lock()
+	entry, ok := tokenVersionCache[claims.UID]
+	tokenVersionMu.Unlock()
+
+	version := entry.version
+	if !ok || !time.Now().Before(entry.until) {
+		var err error
+		if version, err = GetTokenVersion(claims.UID); err != nil {
+			return err
+		}
+	}
+
+	if claims.TokenVersion < version {
+		return ErrTokenRevoked
+	}
+	return nil
+}
+
+func cacheTokenVersion(uid string, version int64) {
+	tokenVersionMu.Lock()
+	tokenVersionCache[uid] = tokenVersionEntry{version: version, until: time.Now().Add(tokenVersionCacheTTL)}
+	tokenVersionMu.Unlock()
+}